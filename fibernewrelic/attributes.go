@@ -0,0 +1,214 @@
+package fibernewrelic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// AppInfo describes the instrumented application.
+type AppInfo struct {
+	// Version is the application version, recorded as app.version on every transaction
+	// Optional. Default: ""
+	Version string
+}
+
+// AddTransactionAttribute adds an attribute to the transaction of the current
+// request. It is a no-op when the request is not instrumented, or once
+// Config.MaxCustomAttributes attributes were added to the transaction.
+func AddTransactionAttribute(c *fiber.Ctx, key string, value interface{}) {
+	state := getRequestState(c)
+	if state == nil {
+		return
+	}
+
+	state.addAttribute(key, value)
+}
+
+// addAttribute is the single place attributes are recorded on a transaction,
+// so that every attribute honours the attribute related config.
+func addAttribute(txn *newrelic.Transaction, cfg *Config, key string, value interface{}) {
+	if cfg.SanitizeAttributes != nil {
+		if value = cfg.SanitizeAttributes(key, value); value == nil {
+			return
+		}
+	}
+
+	if s, ok := value.(string); ok {
+		// Values read from the fiber.Ctx reference buffers reused by Fiber, while
+		// the transaction keeps them until it is harvested.
+		value = utils.CopyString(truncateString(s, cfg.MaxAttributeValueLength))
+	}
+
+	txn.AddAttribute(key, value)
+}
+
+// withEnvironmentTags returns a copy of attrs with the value of every set
+// environment variable of names added as "<prefix><NAME>".
+func withEnvironmentTags(attrs map[string]interface{}, names []string, prefix string) map[string]interface{} {
+	if len(names) == 0 {
+		return attrs
+	}
+
+	merged := make(map[string]interface{}, len(attrs)+len(names))
+	for key, value := range attrs {
+		merged[key] = value
+	}
+
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			merged[prefix+name] = value
+		}
+	}
+
+	return merged
+}
+
+// withHostname returns a copy of attrs with the host name of the server added
+// as server.hostname. attrs is returned as is when the host name is unknown.
+func withHostname(attrs map[string]interface{}) map[string]interface{} {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Errorf("fibernewrelic: unable to record the server hostname: %v", err)
+		return attrs
+	}
+
+	return withAttribute(attrs, "server.hostname", hostname)
+}
+
+// withAppVersion returns a copy of attrs with the application version added as
+// app.version. AppInfo.Version takes precedence over the envVar environment
+// variable; attrs is returned as is when neither is set.
+func withAppVersion(attrs map[string]interface{}, info AppInfo, envVar string) map[string]interface{} {
+	version := info.Version
+	if version == "" && envVar != "" {
+		version = os.Getenv(envVar)
+	}
+
+	if version == "" {
+		return attrs
+	}
+
+	return withAttribute(attrs, "app.version", version)
+}
+
+// withAttribute returns a copy of attrs with key set to value.
+func withAttribute(attrs map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(attrs)+1)
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	merged[key] = value
+
+	return merged
+}
+
+// truncateString shortens s to at most max bytes and appends "...". The cut is
+// moved back to the closest rune boundary so the result stays valid UTF-8.
+func truncateString(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return s[:cut] + "..."
+}
+
+// recordUserContext records the value of every key of keys in ctx as
+// ctx.<key>. Values other than strings, booleans, numbers and fmt.Stringer
+// are skipped with a warning, logged once per key stored in warned.
+func recordUserContext(ctx context.Context, txn *newrelic.Transaction, cfg *Config, keys []interface{}, warned *sync.Map) {
+	for _, key := range keys {
+		value := ctx.Value(key)
+		if value == nil {
+			continue
+		}
+
+		switch v := value.(type) {
+		case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		case fmt.Stringer:
+			value = v.String()
+		default:
+			if _, warned := warned.LoadOrStore(key, struct{}{}); !warned {
+				log.Warnf("fibernewrelic: skipping user context value of %v: unsupported type %T", key, value)
+			}
+			continue
+		}
+
+		addAttribute(txn, cfg, fmt.Sprintf("ctx.%v", key), value)
+	}
+}
+
+// recordAllAttributesWarning is logged when Config.RecordAllAttributes is set.
+const recordAllAttributesWarning = "fibernewrelic: RecordAllAttributes records request data which may contain personal information and increases the New Relic ingest, never use it in production"
+
+// enableAllAttributes sets every boolean attribute recording option of cfg for
+// Config.RecordAllAttributes, and logs recordAllAttributesWarning to
+// Config.LogOutput, or with the Fiber logger when it is nil.
+func enableAllAttributes(cfg *Config) {
+	for _, flag := range []*bool{
+		&cfg.RecordGoroutineCount,
+		&cfg.RecordMemStats,
+		&cfg.RecordRouteHandlerCount,
+		&cfg.FiberVersionAttribute,
+		&cfg.CaptureRequestBody,
+		&cfg.RecordHTTPVersion,
+		&cfg.RecordTLSInfo,
+		&cfg.RecordHostname,
+		&cfg.RecordFiberVersion,
+		&cfg.RecordRouteGroup,
+		&cfg.RecordScheme,
+		&cfg.RecordMethod,
+		&cfg.RecordPort,
+		&cfg.RecordXForwardedFor,
+		&cfg.RecordAcceptHeader,
+		&cfg.RecordContentNegotiation,
+		&cfg.RecordCookieNames,
+		&cfg.RecordQueryParamCount,
+		&cfg.RecordPathDepth,
+		&cfg.RecordServerLoad,
+		&cfg.RecordHandlerName,
+		&cfg.RecordRouteConstraints,
+		&cfg.RecordFormData,
+		&cfg.RecordReferer,
+		&cfg.RecordOrigin,
+		&cfg.RecordForwardedProto,
+		&cfg.RecordETagHeader,
+		&cfg.RecordRateLimitHeaders,
+		&cfg.RecordCacheHeaders,
+		&cfg.RecordResponseTime,
+		&cfg.RecordStatusCodeClass,
+		&cfg.RecordRoute,
+		&cfg.RecordMatchedHost,
+		&cfg.RecordRequestHeaders,
+		&cfg.RecordUserContext,
+		&cfg.RecordRequestSize,
+		&cfg.RecordResponseSize,
+		&cfg.RecordPathParameters,
+		&cfg.RecordQueryString,
+		&cfg.RecordFiberRequestID,
+		&cfg.RecordPanicType,
+		&cfg.ConcurrentRequestsAttribute,
+		&cfg.RequestBodyHashAttribute,
+	} {
+		*flag = true
+	}
+
+	if cfg.LogOutput == nil {
+		log.Warn(recordAllAttributesWarning)
+		return
+	}
+
+	_, _ = fmt.Fprintln(cfg.LogOutput, recordAllAttributesWarning)
+}
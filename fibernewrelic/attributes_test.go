@@ -0,0 +1,381 @@
+package fibernewrelic
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateString(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		max      int
+		expected string
+	}{
+		{name: "no limit", value: "abcdef", max: 0, expected: "abcdef"},
+		{name: "shorter than limit", value: "abc", max: 5, expected: "abc"},
+		{name: "equal to limit", value: "abcde", max: 5, expected: "abcde"},
+		{name: "longer than limit", value: "abcdef", max: 5, expected: "abcde..."},
+		{name: "cut inside multi-byte rune", value: "aé", max: 2, expected: "a..."},
+		{name: "cut after multi-byte rune", value: "éa", max: 2, expected: "é..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, truncateString(tt.value, tt.max))
+		})
+	}
+}
+
+func TestAddTransactionAttribute(t *testing.T) {
+	t.Run("should truncate string values longer than MaxAttributeValueLength", func(t *testing.T) {
+		// given
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, MaxAttributeValueLength: 10}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			AddTransactionAttribute(ctx, "long", strings.Repeat("a", 20))
+			AddTransactionAttribute(ctx, "short", "abc")
+			AddTransactionAttribute(ctx, "number", 12345678901)
+			AddTransactionAttribute(ctx, "flag", true)
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		// when
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+
+		txns := collector.transactionEvents(t, nrApp)
+		if assert.Len(t, txns, 1) {
+			attrs := txns[0].UserAttributes
+			assert.Equal(t, strings.Repeat("a", 10)+"...", attrs["long"])
+			assert.Equal(t, "abc", attrs["short"])
+			assert.Equal(t, float64(12345678901), attrs["number"])
+			assert.Equal(t, true, attrs["flag"])
+		}
+	})
+
+	t.Run("should be a no-op for requests which are not instrumented", func(t *testing.T) {
+		app := fiber.New()
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			AddTransactionAttribute(ctx, "key", "value")
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestMaxCustomAttributes(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		max      int
+		added    int
+		expected int
+		exceeded bool
+	}{
+		{name: "should add the attributes below the limit", max: 3, added: 3, expected: 3, exceeded: false},
+		{name: "should drop the attributes above the limit", max: 3, added: 5, expected: 3, exceeded: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, MaxCustomAttributes: tt.max}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				for i := 0; i < tt.added; i++ {
+					AddTransactionAttribute(ctx, "attr"+strconv.Itoa(i), i)
+				}
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+
+			attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+			for i := 0; i < tt.added; i++ {
+				if i < tt.expected {
+					assert.Contains(t, attrs, "attr"+strconv.Itoa(i))
+				} else {
+					assert.NotContains(t, attrs, "attr"+strconv.Itoa(i))
+				}
+			}
+			if tt.exceeded {
+				assert.Equal(t, true, attrs["nrMaxAttrsExceeded"])
+			} else {
+				assert.NotContains(t, attrs, "nrMaxAttrsExceeded")
+			}
+		})
+	}
+}
+
+type testContextKey string
+
+type testStringer struct{ name string }
+
+func (s testStringer) String() string { return "stringer:" + s.name }
+
+func TestRecordUserContext(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	cfg := Config{
+		Application:       nrApp,
+		RecordUserContext: true,
+		UserContextKeys: []interface{}{
+			testContextKey("tenant"), testContextKey("retries"), testContextKey("plan"),
+			testContextKey("raw"), testContextKey("missing"),
+		},
+	}
+	handler := func(ctx *fiber.Ctx) error {
+		userCtx := ctx.UserContext()
+		userCtx = context.WithValue(userCtx, testContextKey("tenant"), "acme")
+		userCtx = context.WithValue(userCtx, testContextKey("retries"), 2)
+		userCtx = context.WithValue(userCtx, testContextKey("plan"), testStringer{name: "pro"})
+		userCtx = context.WithValue(userCtx, testContextKey("raw"), []string{"unsupported"})
+		ctx.SetUserContext(userCtx)
+		return ctx.SendStatus(http.StatusOK)
+	}
+	app := fiber.New()
+	app.Use(New(cfg))
+	app.Get("/", handler)
+	other := fiber.New()
+	other.Use(New(cfg))
+	other.Get("/", handler)
+
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// when
+	for i := 0; i < 2; i++ {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+	}
+
+	_, err := other.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+
+	// then
+	// once per middleware
+	assert.Equal(t, 2, strings.Count(output.String(), "skipping user context value of raw"))
+
+	attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+	assert.Equal(t, "acme", attrs["ctx.tenant"])
+	assert.Equal(t, float64(2), attrs["ctx.retries"])
+	assert.Equal(t, "stringer:pro", attrs["ctx.plan"])
+	assert.NotContains(t, attrs, "ctx.raw")
+	assert.NotContains(t, attrs, "ctx.missing")
+}
+
+func TestTagsFromEnvironment(t *testing.T) {
+	// given
+	t.Setenv("FIBERNEWRELIC_REGION", "eu-west-1")
+	t.Setenv("FIBERNEWRELIC_VERSION", "1.2.3")
+
+	nrApp, collector := newTestApplication(t)
+	custom := map[string]interface{}{"team": "payments"}
+	app := fiber.New()
+	app.Use(New(Config{
+		Application:         nrApp,
+		CustomAttributes:    custom,
+		TagsFromEnvironment: []string{"FIBERNEWRELIC_REGION", "FIBERNEWRELIC_VERSION", "FIBERNEWRELIC_MISSING"},
+	}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, custom, 1, "the configured map should not be modified")
+
+	attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+	assert.Equal(t, "payments", attrs["team"])
+	assert.Equal(t, "eu-west-1", attrs["env.FIBERNEWRELIC_REGION"])
+	assert.Equal(t, "1.2.3", attrs["env.FIBERNEWRELIC_VERSION"])
+	assert.NotContains(t, attrs, "env.FIBERNEWRELIC_MISSING")
+}
+
+func TestRecordEnvironmentVars(t *testing.T) {
+	// given
+	t.Setenv("FIBERNEWRELIC_POD_NAME", "api-7d9f")
+	t.Setenv("FIBERNEWRELIC_NAMESPACE", "payments")
+
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application:           nrApp,
+		RecordEnvironmentVars: []string{"FIBERNEWRELIC_POD_NAME", "FIBERNEWRELIC_MISSING"},
+		TagsFromEnvironment:   []string{"FIBERNEWRELIC_NAMESPACE"},
+	}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+
+	attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+	assert.Equal(t, "api-7d9f", attrs["FIBERNEWRELIC_POD_NAME"])
+	assert.Equal(t, "payments", attrs["env.FIBERNEWRELIC_NAMESPACE"])
+	assert.NotContains(t, attrs, "FIBERNEWRELIC_MISSING")
+	assert.NotContains(t, attrs, "env.FIBERNEWRELIC_POD_NAME")
+}
+
+func TestRecordHostname(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	for _, enabled := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordHostname: enabled}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		for i := 0; i < 2; i++ {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+		}
+
+		txns := collector.transactionEvents(t, nrApp)
+		assert.Len(t, txns, 2)
+		for _, txn := range txns {
+			if enabled {
+				assert.Equal(t, hostname, txn.UserAttributes["server.hostname"])
+			} else {
+				assert.NotContains(t, txn.UserAttributes, "server.hostname")
+			}
+		}
+	}
+}
+
+func TestAppVersion(t *testing.T) {
+	t.Setenv("FIBERNEWRELIC_APP_VERSION", "sha-1234")
+
+	tests := []struct {
+		name     string
+		info     AppInfo
+		envVar   string
+		expected interface{}
+	}{
+		{name: "should read the version from the env var", envVar: "FIBERNEWRELIC_APP_VERSION", expected: "sha-1234"},
+		{name: "should prefer AppInfo.Version", info: AppInfo{Version: "1.2.3"}, envVar: "FIBERNEWRELIC_APP_VERSION", expected: "1.2.3"},
+		{name: "should skip unset env vars", envVar: "FIBERNEWRELIC_MISSING", expected: nil},
+		{name: "should not record the version by default", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, AppInfo: tt.info, AppVersionFromEnv: tt.envVar}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, tt.expected, txn.UserAttributes["app.version"])
+		})
+	}
+}
+
+func TestTransactionAttributes(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application: nrApp,
+		TransactionAttributes: func(c *fiber.Ctx) map[string]interface{} {
+			return map[string]interface{}{
+				"user.email":  c.Get("X-User-Email"),
+				"tenant":      c.Get("X-Tenant"),
+				"cart.items":  3,
+				"cart.hidden": "secret",
+			}
+		},
+		SanitizeAttributes: func(key string, value interface{}) interface{} {
+			switch key {
+			case "user.email":
+				return "***"
+			case "cart.hidden":
+				return nil
+			default:
+				return value
+			}
+		},
+	}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User-Email", "jane@example.com")
+	req.Header.Set("X-Tenant", "acme")
+
+	// when
+	_, err := app.Test(req, -1)
+
+	// then
+	assert.NoError(t, err)
+
+	attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+	assert.Equal(t, "***", attrs["user.email"])
+	assert.Equal(t, "acme", attrs["tenant"])
+	assert.Equal(t, float64(3), attrs["cart.items"])
+	assert.NotContains(t, attrs, "cart.hidden")
+}
+
+func TestRecordAllAttributes(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordAllAttributes: true, LogOutput: &output}))
+	app.Post("/orders/:id", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusCreated)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodPost, "/orders/42?expand=items", strings.NewReader(`{"amount":10}`)), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, recordAllAttributesWarning+"\n", output.String())
+
+	attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /orders/42").UserAttributes
+	assert.Equal(t, "POST", attrs["request.method"])
+	assert.Equal(t, "/orders/:id", attrs["fiber.route"])
+	assert.Equal(t, "42", attrs["request.parameters.id"])
+	assert.Equal(t, "expand=items", attrs["request.queryString"])
+	assert.Contains(t, attrs, "request.bodyHash")
+	assert.Contains(t, attrs, "response.totalBytes")
+	assert.NotContains(t, attrs, "cloud.provider")
+}
@@ -0,0 +1,99 @@
+package fibernewrelic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// ParseBody binds the request body into out with c.BodyParser, timing it in a
+// Config.BodyParserSegmentName segment of the transaction of the current
+// request. Bodies larger than Config.MaxBodySegmentSize are parsed without a
+// segment and flagged with the request.bodyTruncated attribute instead.
+func ParseBody(c *fiber.Ctx, out interface{}) error {
+	state := getRequestState(c)
+	if state == nil {
+		return c.BodyParser(out)
+	}
+
+	if !bodyWithinLimit(c, state.cfg.MaxBodySegmentSize) {
+		addAttribute(state.txn, state.cfg, "request.bodyTruncated", true)
+		return c.BodyParser(out)
+	}
+
+	defer StartSegment(c, state.cfg.BodyParserSegmentName).End()
+
+	return c.BodyParser(out)
+}
+
+// bodyWithinLimit reports whether the request body is small enough to be
+// instrumented. A negative limit disables the check.
+func bodyWithinLimit(c *fiber.Ctx, limit int64) bool {
+	return limit < 0 || int64(len(c.Request().Body())) <= limit
+}
+
+// bodyHash returns the first 16 hex characters of the SHA-256 of the raw
+// request body, or "" for empty, streamed or larger than maxBytes bodies.
+func bodyHash(c *fiber.Ctx, maxBytes int64) string {
+	if c.Request().IsBodyStream() {
+		return ""
+	}
+
+	body := c.Request().Body()
+	if len(body) == 0 || int64(len(body)) > maxBytes {
+		return ""
+	}
+
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// recordFormFields records the sorted names of the value and file fields of
+// a multipart form request, at most maxFields of each. Values are never
+// recorded. Streamed bodies and bodies larger than Config.MaxBodySegmentSize
+// are not parsed, as handlers not reading the form would pay for it.
+func recordFormFields(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config, maxFields int) {
+	if !strings.HasPrefix(utils.ToLower(c.Get(fiber.HeaderContentType)), fiber.MIMEMultipartForm) {
+		return
+	}
+
+	if c.Request().IsBodyStream() || !bodyWithinLimit(c, cfg.MaxBodySegmentSize) {
+		return
+	}
+
+	// The parsed form is cached by fasthttp, so handlers parsing the form do
+	// not pay for it twice.
+	form, err := c.MultipartForm()
+	if err != nil {
+		return
+	}
+
+	if names := formFieldNames(form.Value, maxFields); names != "" {
+		addAttribute(txn, cfg, "request.formFields", names)
+	}
+	if names := formFieldNames(form.File, maxFields); names != "" {
+		addAttribute(txn, cfg, "request.fileFields", names)
+	}
+}
+
+// formFieldNames returns up to maxFields sorted keys of fields, separated by
+// commas.
+func formFieldNames[V any](fields map[string]V, maxFields int) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) > maxFields {
+		names = names[:maxFields]
+	}
+
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,391 @@
+package fibernewrelic
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBody(t *testing.T) {
+	newApp := func(cfg Config) *fiber.App {
+		app := fiber.New()
+		app.Use(New(cfg))
+		app.Post("/", func(ctx *fiber.Ctx) error {
+			var body struct {
+				Name string `json:"name"`
+			}
+			if err := ParseBody(ctx, &body); err != nil {
+				return err
+			}
+			return ctx.SendString(body.Name)
+		})
+		return app
+	}
+
+	jsonRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return req
+	}
+
+	t.Run("should time small bodies in a segment", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := newApp(Config{Application: nrApp, MaxBodySegmentSize: 64})
+
+		resp, err := app.Test(jsonRequest(`{"name":"john"}`), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Contains(t, collector.metrics(t, nrApp), "Custom/"+ConfigDefault.BodyParserSegmentName)
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /")
+		assert.NotContains(t, txn.UserAttributes, "request.bodyTruncated")
+	})
+
+	t.Run("should skip the segment for large bodies", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := newApp(Config{Application: nrApp, MaxBodySegmentSize: 64})
+
+		resp, err := app.Test(jsonRequest(`{"name":"`+strings.Repeat("a", 100)+`"}`), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.NotContains(t, collector.metrics(t, nrApp), "Custom/"+ConfigDefault.BodyParserSegmentName)
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /")
+		assert.Equal(t, true, txn.UserAttributes["request.bodyTruncated"])
+	})
+
+	t.Run("should parse the body when not instrumented", func(t *testing.T) {
+		app := fiber.New()
+		app.Post("/", func(ctx *fiber.Ctx) error {
+			var body struct {
+				Name string `json:"name"`
+			}
+			if err := ParseBody(ctx, &body); err != nil {
+				return err
+			}
+			return ctx.SendString(body.Name)
+		})
+
+		resp, err := app.Test(jsonRequest(`{"name":"john"}`), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestBodyParserSegmentName(t *testing.T) {
+	tests := []struct {
+		name     string
+		segment  string
+		expected string
+	}{
+		{name: "should use the default name", segment: "", expected: "Custom/request/body-parsing"},
+		{name: "should use the configured name", segment: "decode", expected: "Custom/decode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, BodyParserSegmentName: tt.segment}))
+			app.Post("/", func(ctx *fiber.Ctx) error {
+				var body map[string]interface{}
+				return ParseBody(ctx, &body)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			_, err := app.Test(req, -1)
+			assert.NoError(t, err)
+
+			assert.Contains(t, collector.metrics(t, nrApp), tt.expected)
+		})
+	}
+}
+
+func TestCaptureRequestBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected interface{}
+	}{
+		{name: "should capture the body on 5xx", status: http.StatusInternalServerError, expected: "0123456789..."},
+		{name: "should not capture the body on 2xx", status: http.StatusOK, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, CaptureRequestBody: true, MaxCapturedBodyBytes: 10}))
+			app.Post("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(tt.status)
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789abcdef")), -1)
+
+			// then
+			assert.NoError(t, err)
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /")
+			assert.Equal(t, tt.expected, txn.UserAttributes["request.body"])
+		})
+	}
+}
+
+func TestCaptureRequestBodyCompressed(t *testing.T) {
+	// given
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err := zw.Write([]byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, CaptureRequestBody: true}))
+	app.Post("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set(fiber.HeaderContentEncoding, "gzip")
+
+	// when
+	_, err = app.Test(req, -1)
+
+	// then
+	assert.NoError(t, err)
+	txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /")
+	body, _ := txn.UserAttributes["request.body"].(string)
+	// The gzip magic number, the body is not decoded.
+	assert.True(t, strings.HasPrefix(body, "\x1f"), "body %q", body)
+}
+
+func TestRecordFormData(t *testing.T) {
+	newRequest := func(t *testing.T) *http.Request {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		assert.NoError(t, w.WriteField("password", "secret"))
+		assert.NoError(t, w.WriteField("email", "user@example.com"))
+		assert.NoError(t, w.WriteField("name", "user"))
+		fw, err := w.CreateFormFile("avatar", "avatar.png")
+		assert.NoError(t, err)
+		_, err = fw.Write([]byte("png"))
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+		return req
+	}
+
+	tests := []struct {
+		name           string
+		cfg            Config
+		expectedFields interface{}
+		expectedFiles  interface{}
+	}{
+		{name: "should record the field names", cfg: Config{RecordFormData: true}, expectedFields: "email,name,password", expectedFiles: "avatar"},
+		{name: "should cap the field names", cfg: Config{RecordFormData: true, MaxFormDataFields: 2}, expectedFields: "email,name", expectedFiles: "avatar"},
+		{name: "should not record the field names when disabled", cfg: Config{}, expectedFields: nil, expectedFiles: nil},
+		{name: "should not parse bodies over MaxBodySegmentSize", cfg: Config{RecordFormData: true, MaxBodySegmentSize: 10}, expectedFields: nil, expectedFiles: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			tt.cfg.Application = nrApp
+			app := fiber.New()
+			app.Use(New(tt.cfg))
+			app.Post("/", func(ctx *fiber.Ctx) error {
+				assert.Equal(t, "secret", ctx.FormValue("password"))
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			_, err := app.Test(newRequest(t), -1)
+
+			// then
+			assert.NoError(t, err)
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /")
+			assert.Equal(t, tt.expectedFields, txn.UserAttributes["request.formFields"])
+			assert.Equal(t, tt.expectedFiles, txn.UserAttributes["request.fileFields"])
+			for _, value := range txn.UserAttributes {
+				assert.NotEqual(t, "secret", value)
+			}
+		})
+	}
+
+	t.Run("should ignore other content types", func(t *testing.T) {
+		// given
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordFormData: true}))
+		app.Post("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("name=user"))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+
+		// when
+		_, err := app.Test(req, -1)
+
+		// then
+		assert.NoError(t, err)
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /")
+		assert.NotContains(t, txn.UserAttributes, "request.formFields")
+		assert.NotContains(t, txn.UserAttributes, "request.fileFields")
+	})
+}
+
+func TestRequestBodyHashAttribute(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RequestBodyHashAttribute: true, MaxBodyHashBytes: 16}))
+	app.Post("/*", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	bodies := map[string]string{
+		"/first":  `{"amount":10}`,
+		"/second": `{"amount":10}`,
+		"/other":  `{"amount":20}`,
+		"/large":  `{"amount":10000000}`,
+		"/empty":  "",
+	}
+
+	// when
+	for path, body := range bodies {
+		_, err := app.Test(httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	first := findTransaction(t, txns, "POST /first").UserAttributes["request.bodyHash"]
+	assert.Regexp(t, "^[0-9a-f]{16}$", first)
+	assert.Equal(t, first, findTransaction(t, txns, "POST /second").UserAttributes["request.bodyHash"])
+	other := findTransaction(t, txns, "POST /other").UserAttributes["request.bodyHash"]
+	assert.Regexp(t, "^[0-9a-f]{16}$", other)
+	assert.NotEqual(t, first, other)
+	assert.NotContains(t, findTransaction(t, txns, "POST /large").UserAttributes, "request.bodyHash")
+	assert.NotContains(t, findTransaction(t, txns, "POST /empty").UserAttributes, "request.bodyHash")
+}
+
+func TestRecordRequestSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxRead int64
+		body    string
+		counted int
+	}{
+		{name: "should count the headers and body", maxRead: 0, body: "0123456789", counted: 10},
+		{name: "should cap the counted body", maxRead: 4, body: "0123456789", counted: 4},
+		{name: "should count requests without body", maxRead: 0, body: "", counted: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			var headerSize int
+
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, RecordRequestSize: true, MaxRequestSizeRead: tt.maxRead}))
+			app.Post("/upload", func(ctx *fiber.Ctx) error {
+				headerSize = len(ctx.Request().Header.Header())
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tt.body))
+			req.Header.Set("X-Padding", strings.Repeat("p", 100))
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Greater(t, headerSize, 100)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /upload")
+			assert.Equal(t, float64(headerSize+tt.counted), txn.UserAttributes["request.totalBytes"])
+		})
+	}
+}
+
+func TestRecordResponseSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler fiber.Handler
+		counted int
+	}{
+		{
+			name: "should count the headers and body",
+			handler: func(ctx *fiber.Ctx) error {
+				return ctx.SendString("0123456789")
+			},
+			counted: 10,
+		},
+		{
+			name: "should count the actual body instead of the content length",
+			handler: func(ctx *fiber.Ctx) error {
+				ctx.Response().Header.SetContentLength(1000)
+				ctx.Response().SetBodyRaw([]byte("0123456789"))
+				return nil
+			},
+			counted: 10,
+		},
+		{
+			name: "should count streamed bodies of known size",
+			handler: func(ctx *fiber.Ctx) error {
+				return ctx.SendStream(strings.NewReader("0123456789"), 10)
+			},
+			counted: 10,
+		},
+		{
+			name: "should not count chunked bodies",
+			handler: func(ctx *fiber.Ctx) error {
+				return ctx.SendStream(strings.NewReader("0123456789"), -1)
+			},
+			counted: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			var headerSize int
+
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(func(ctx *fiber.Ctx) error {
+				err := ctx.Next()
+				headerSize = len(ctx.Response().Header.Header())
+				return err
+			})
+			app.Use(New(Config{Application: nrApp, RecordResponseSize: true}))
+			app.Get("/", tt.handler)
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, float64(headerSize+tt.counted), txn.UserAttributes["response.totalBytes"])
+		})
+	}
+}
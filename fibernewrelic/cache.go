@@ -0,0 +1,49 @@
+package fibernewrelic
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// recordCacheHeaders records the Cache-Control, X-Cache and Age headers of the
+// response allowed by headers, and the max-age directive of Cache-Control as
+// an integer.
+func recordCacheHeaders(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config, headers headerFilter) {
+	if cacheControl := headers.response(c, fiber.HeaderCacheControl); cacheControl != "" {
+		addAttribute(txn, cfg, "response.cacheControl", cacheControl)
+
+		if maxAge, ok := cacheMaxAge(cacheControl); ok {
+			addAttribute(txn, cfg, "response.cacheMaxAge", maxAge)
+		}
+	}
+
+	if xCache := headers.response(c, "X-Cache"); xCache != "" {
+		addAttribute(txn, cfg, "response.xCache", xCache)
+	}
+
+	if age := headers.response(c, fiber.HeaderAge); age != "" {
+		if n, err := strconv.ParseInt(age, 10, 64); err == nil {
+			addAttribute(txn, cfg, "response.age", n)
+		}
+	}
+}
+
+// cacheMaxAge returns the value of the max-age directive of a Cache-Control
+// header.
+func cacheMaxAge(cacheControl string) (int64, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, ok := strings.Cut(utils.Trim(directive, ' '), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+
+		maxAge, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		return maxAge, err == nil
+	}
+
+	return 0, false
+}
@@ -0,0 +1,73 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordCacheHeaders(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordCacheHeaders: true}))
+	app.Get("/no-cache", func(ctx *fiber.Ctx) error {
+		ctx.Set(fiber.HeaderCacheControl, "no-cache")
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/public", func(ctx *fiber.Ctx) error {
+		ctx.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+		ctx.Set("X-Cache", "HIT")
+		ctx.Set(fiber.HeaderAge, "120")
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/none", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, url := range []string{"/no-cache", "/public", "/none"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+
+	attrs := findTransaction(t, txns, "GET /no-cache").UserAttributes
+	assert.Equal(t, "no-cache", attrs["response.cacheControl"])
+	assert.NotContains(t, attrs, "response.cacheMaxAge")
+
+	attrs = findTransaction(t, txns, "GET /public").UserAttributes
+	assert.Equal(t, "public, max-age=3600", attrs["response.cacheControl"])
+	assert.Equal(t, float64(3600), attrs["response.cacheMaxAge"])
+	assert.Equal(t, "HIT", attrs["response.xCache"])
+	assert.Equal(t, float64(120), attrs["response.age"])
+
+	attrs = findTransaction(t, txns, "GET /none").UserAttributes
+	for _, key := range []string{"response.cacheControl", "response.cacheMaxAge", "response.xCache", "response.age"} {
+		assert.NotContains(t, attrs, key)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	for _, tt := range []struct {
+		cacheControl string
+		maxAge       int64
+		ok           bool
+	}{
+		{cacheControl: "max-age=60", maxAge: 60, ok: true},
+		{cacheControl: "public,  MAX-AGE=3600, must-revalidate", maxAge: 3600, ok: true},
+		{cacheControl: `max-age="10"`, maxAge: 10, ok: true},
+		{cacheControl: "s-maxage=60", ok: false},
+		{cacheControl: "max-age=soon", ok: false},
+		{cacheControl: "no-store", ok: false},
+	} {
+		maxAge, ok := cacheMaxAge(tt.cacheControl)
+		assert.Equal(t, tt.ok, ok, tt.cacheControl)
+		assert.Equal(t, tt.maxAge, maxAge, tt.cacheControl)
+	}
+}
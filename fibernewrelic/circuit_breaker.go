@@ -0,0 +1,34 @@
+package fibernewrelic
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// CircuitBreakerStateFunc returns the current state of a circuit breaker:
+// "closed", "open" or "half-open".
+type CircuitBreakerStateFunc func() string
+
+// circuitBreakerStateValues are the metric values of the circuit breaker
+// states.
+var circuitBreakerStateValues = map[string]float64{
+	"closed":    0,
+	"half-open": 0.5,
+	"open":      1,
+}
+
+// WrapCircuitBreaker returns a handler recording the state of the circuit
+// breaker cb as the Custom/CircuitBreaker/<name>/state metric on every request:
+// 0 when closed, 0.5 when half-open and 1 when open. Unknown states are not
+// recorded.
+func WrapCircuitBreaker(app *newrelic.Application, name string, cb CircuitBreakerStateFunc) fiber.Handler {
+	metricName := "CircuitBreaker/" + name + "/state"
+
+	return func(c *fiber.Ctx) error {
+		if value, ok := circuitBreakerStateValues[cb()]; ok {
+			app.RecordCustomMetric(metricName, value)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,49 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		state    string
+		expected float64
+		recorded bool
+	}{
+		{state: "closed", expected: 0, recorded: true},
+		{state: "half-open", expected: 0.5, recorded: true},
+		{state: "open", expected: 1, recorded: true},
+		{state: "broken", recorded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(WrapCircuitBreaker(nrApp, "payments", func() string { return tt.state }))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			totals := collector.metricTotals(t, nrApp)
+			if tt.recorded {
+				assert.Equal(t, tt.expected, totals["Custom/CircuitBreaker/payments/state"])
+			} else {
+				assert.NotContains(t, totals, "Custom/CircuitBreaker/payments/state")
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package fibernewrelic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+const (
+	// CloudProviderAuto tries the metadata endpoints of every supported provider.
+	CloudProviderAuto = "auto"
+	// CloudProviderAWS reads the EC2 instance metadata.
+	CloudProviderAWS = "aws"
+	// CloudProviderGCP reads the Compute Engine instance metadata.
+	CloudProviderGCP = "gcp"
+	// CloudProviderAzure reads the Azure virtual machine instance metadata.
+	CloudProviderAzure = "azure"
+)
+
+// cloudMetadataTimeout bounds the detection of the cloud metadata, across all
+// the providers tried.
+const cloudMetadataTimeout = 500 * time.Millisecond
+
+// metadataClient fetches the instance metadata. It never uses a proxy from the
+// environment, as the endpoints, and the AWS session token, are link local.
+var metadataClient = &http.Client{
+	Transport: &http.Transport{Proxy: nil},
+	Timeout:   cloudMetadataTimeout,
+}
+
+// Instance metadata endpoints, replaced by tests.
+var (
+	awsMetadataURL   = "http://169.254.169.254"
+	gcpMetadataURL   = "http://metadata.google.internal"
+	azureMetadataURL = "http://169.254.169.254"
+)
+
+// cloudMetadata is the instance metadata recorded by Config.RecordCloudMetadata.
+type cloudMetadata struct {
+	provider     string
+	instanceType string
+	region       string
+	zone         string
+}
+
+func (m *cloudMetadata) attributes() map[string]interface{} {
+	attrs := map[string]interface{}{"cloud.provider": m.provider}
+	for key, value := range map[string]string{
+		"cloud.instanceType": m.instanceType,
+		"cloud.region":       m.region,
+		"cloud.zone":         m.zone,
+	} {
+		if value != "" {
+			attrs[key] = value
+		}
+	}
+
+	return attrs
+}
+
+var cloudMetadataFetchers = map[string]func(ctx context.Context) (*cloudMetadata, error){
+	CloudProviderAWS:   fetchAWSMetadata,
+	CloudProviderGCP:   fetchGCPMetadata,
+	CloudProviderAzure: fetchAzureMetadata,
+}
+
+// validateCloudProvider returns an error for an unknown Config.CloudProvider.
+func validateCloudProvider(provider string) error {
+	if _, ok := cloudMetadataFetchers[provider]; !ok && provider != "" && provider != CloudProviderAuto {
+		return fmt.Errorf("unable to create New Relic Application -> unknown CloudProvider %q", provider)
+	}
+
+	return nil
+}
+
+// withCloudMetadata returns a copy of attrs with the instance metadata of the
+// cloud provider added. With CloudProviderAuto, the providers are tried in
+// turn. attrs is returned as is when no metadata can be fetched.
+func withCloudMetadata(attrs map[string]interface{}, provider string) map[string]interface{} {
+	providers := []string{provider}
+	if provider == "" || provider == CloudProviderAuto {
+		providers = []string{CloudProviderAWS, CloudProviderGCP, CloudProviderAzure}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cloudMetadataTimeout)
+	defer cancel()
+
+	for _, p := range providers {
+		metadata, err := cloudMetadataFetchers[p](ctx)
+		if err != nil {
+			continue
+		}
+
+		merged := make(map[string]interface{}, len(attrs)+4)
+		for key, value := range attrs {
+			merged[key] = value
+		}
+		for key, value := range metadata.attributes() {
+			merged[key] = value
+		}
+
+		return merged
+	}
+
+	log.Warnf("fibernewrelic: unable to fetch the cloud metadata of %s", strings.Join(providers, ", "))
+	return attrs
+}
+
+func fetchAWSMetadata(ctx context.Context) (*cloudMetadata, error) {
+	// IMDSv2 requires a session token.
+	token, err := fetchMetadata(ctx, http.MethodPut, awsMetadataURL+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := fetchMetadata(ctx, http.MethodGet, awsMetadataURL+"/latest/dynamic/instance-identity/document",
+		map[string]string{"X-aws-ec2-metadata-token": string(token)})
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		InstanceType     string `json:"instanceType"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	return &cloudMetadata{
+		provider:     CloudProviderAWS,
+		instanceType: doc.InstanceType,
+		region:       doc.Region,
+		zone:         doc.AvailabilityZone,
+	}, nil
+}
+
+func fetchGCPMetadata(ctx context.Context) (*cloudMetadata, error) {
+	body, err := fetchMetadata(ctx, http.MethodGet, gcpMetadataURL+"/computeMetadata/v1/instance/?recursive=true",
+		map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return nil, err
+	}
+
+	// The machine type and zone are resource names, e.g.
+	// "projects/123/zones/us-central1-a".
+	var doc struct {
+		MachineType string `json:"machineType"`
+		Zone        string `json:"zone"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	metadata := &cloudMetadata{provider: CloudProviderGCP}
+	if doc.MachineType != "" {
+		metadata.instanceType = path.Base(doc.MachineType)
+	}
+	if doc.Zone != "" {
+		metadata.zone = path.Base(doc.Zone)
+		if i := strings.LastIndexByte(metadata.zone, '-'); i > 0 {
+			metadata.region = metadata.zone[:i]
+		}
+	}
+
+	return metadata, nil
+}
+
+func fetchAzureMetadata(ctx context.Context) (*cloudMetadata, error) {
+	body, err := fetchMetadata(ctx, http.MethodGet, azureMetadataURL+"/metadata/instance/compute?api-version=2021-02-01",
+		map[string]string{"Metadata": "true"})
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		VMSize   string `json:"vmSize"`
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+
+	return &cloudMetadata{
+		provider:     CloudProviderAzure,
+		instanceType: doc.VMSize,
+		region:       doc.Location,
+		zone:         doc.Zone,
+	}, nil
+}
+
+func fetchMetadata(ctx context.Context, method, url string, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,150 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMetadataServers points the instance metadata endpoints to test servers
+// serving the metadata of the given providers.
+func fakeMetadataServers(t *testing.T, providers ...string) {
+	t.Helper()
+
+	serves := map[string]bool{}
+	for _, provider := range providers {
+		serves[provider] = true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if !serves[CloudProviderAWS] || r.Method != http.MethodPut {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("token"))
+	})
+	mux.HandleFunc("/latest/dynamic/instance-identity/document", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"instanceType":"t3.micro","region":"eu-west-1","availabilityZone":"eu-west-1b"}`))
+	})
+	mux.HandleFunc("/computeMetadata/v1/instance/", func(w http.ResponseWriter, r *http.Request) {
+		if !serves[CloudProviderGCP] || r.Header.Get("Metadata-Flavor") != "Google" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"machineType":"projects/123/machineTypes/e2-small","zone":"projects/123/zones/us-central1-a"}`))
+	})
+	mux.HandleFunc("/metadata/instance/compute", func(w http.ResponseWriter, r *http.Request) {
+		if !serves[CloudProviderAzure] || r.Header.Get("Metadata") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"vmSize":"Standard_B1s","location":"westeurope","zone":"2"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	aws, gcp, azure := awsMetadataURL, gcpMetadataURL, azureMetadataURL
+	t.Cleanup(func() {
+		awsMetadataURL, gcpMetadataURL, azureMetadataURL = aws, gcp, azure
+	})
+	awsMetadataURL, gcpMetadataURL, azureMetadataURL = server.URL, server.URL, server.URL
+}
+
+func TestWithCloudMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		serves   []string
+		provider string
+		expected map[string]interface{}
+	}{
+		{
+			name: "should record the aws metadata", serves: []string{CloudProviderAWS}, provider: CloudProviderAWS,
+			expected: map[string]interface{}{"cloud.provider": "aws", "cloud.instanceType": "t3.micro", "cloud.region": "eu-west-1", "cloud.zone": "eu-west-1b"},
+		},
+		{
+			name: "should record the gcp metadata", serves: []string{CloudProviderGCP}, provider: CloudProviderGCP,
+			expected: map[string]interface{}{"cloud.provider": "gcp", "cloud.instanceType": "e2-small", "cloud.region": "us-central1", "cloud.zone": "us-central1-a"},
+		},
+		{
+			name: "should record the azure metadata", serves: []string{CloudProviderAzure}, provider: CloudProviderAzure,
+			expected: map[string]interface{}{"cloud.provider": "azure", "cloud.instanceType": "Standard_B1s", "cloud.region": "westeurope", "cloud.zone": "2"},
+		},
+		{
+			name: "should detect the provider", serves: []string{CloudProviderAzure}, provider: CloudProviderAuto,
+			expected: map[string]interface{}{"cloud.provider": "azure", "cloud.instanceType": "Standard_B1s", "cloud.region": "westeurope", "cloud.zone": "2"},
+		},
+		{
+			name: "should only query the configured provider", serves: []string{CloudProviderGCP}, provider: CloudProviderAWS,
+			expected: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeMetadataServers(t, tt.serves...)
+
+			attrs := withCloudMetadata(map[string]interface{}{}, tt.provider)
+
+			assert.Equal(t, tt.expected, attrs)
+		})
+	}
+
+	t.Run("should fail silently when the endpoints are unreachable", func(t *testing.T) {
+		fakeMetadataServers(t)
+		awsMetadataURL, gcpMetadataURL, azureMetadataURL = "http://127.0.0.1:0", "http://127.0.0.1:0", "http://127.0.0.1:0"
+
+		attrs := withCloudMetadata(map[string]interface{}{"team": "payments"}, CloudProviderAuto)
+
+		assert.Equal(t, map[string]interface{}{"team": "payments"}, attrs)
+	})
+	t.Run("should not fetch the metadata through a proxy", func(t *testing.T) {
+		transport, ok := metadataClient.Transport.(*http.Transport)
+
+		assert.True(t, ok)
+		assert.Nil(t, transport.Proxy)
+		assert.Equal(t, cloudMetadataTimeout, metadataClient.Timeout)
+	})
+}
+
+func TestRecordCloudMetadata(t *testing.T) {
+	t.Run("should record the metadata on every transaction", func(t *testing.T) {
+		// given
+		fakeMetadataServers(t, CloudProviderAWS)
+
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordCloudMetadata: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		// when
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+		assert.Equal(t, "aws", attrs["cloud.provider"])
+		assert.Equal(t, "t3.micro", attrs["cloud.instanceType"])
+	})
+
+	t.Run("should return an error for an unknown provider", func(t *testing.T) {
+		handler, err := NewE(Config{
+			License:             "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+			RecordCloudMetadata: true,
+			CloudProvider:       "oracle",
+		})
+
+		assert.Error(t, err)
+		assert.Nil(t, handler)
+	})
+}
@@ -0,0 +1,154 @@
+package fibernewrelic
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofiber/contrib/fibernewrelic/internal/collector"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/require"
+)
+
+const testLicense = "0123456789abcdef0123456789abcdef01234567"
+
+// testCollector is the in-memory collector the test applications report to.
+type testCollector struct {
+	*collector.Collector
+}
+
+// harvestedEvent is a single transaction, error, span or custom event as sent
+// to the collector.
+type harvestedEvent = collector.Event
+
+// newTestApplication creates a connected New Relic application which reports
+// to an in-memory collector.
+func newTestApplication(t testing.TB, opts ...newrelic.ConfigOption) (*newrelic.Application, *testCollector) {
+	t.Helper()
+
+	tc := &testCollector{collector.New()}
+
+	opts = append([]newrelic.ConfigOption{
+		newrelic.ConfigAppName("fibernewrelic-test"),
+		newrelic.ConfigLicense(testLicense),
+		newrelic.ConfigEnabled(true),
+		func(cfg *newrelic.Config) { cfg.Transport = tc },
+	}, opts...)
+
+	app, err := newrelic.NewApplication(opts...)
+	require.NoError(t, err)
+	require.NoError(t, app.WaitForConnection(5*time.Second))
+
+	return app, tc
+}
+
+// newDelayedApplication creates a New Relic application whose connection to
+// the in-memory collector takes delay. It does not wait for the connection.
+func newDelayedApplication(t *testing.T, delay time.Duration) *newrelic.Application {
+	t.Helper()
+
+	tc := &testCollector{collector.New()}
+	tc.ConnectDelay = delay
+	app, err := newrelic.NewApplication(
+		newrelic.ConfigAppName("fibernewrelic-test"),
+		newrelic.ConfigLicense(testLicense),
+		newrelic.ConfigEnabled(true),
+		func(cfg *newrelic.Config) { cfg.Transport = tc },
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { app.Shutdown(time.Second) })
+
+	return app
+}
+
+// harvest shuts the application down, which flushes all pending data to the
+// collector.
+func (tc *testCollector) harvest(app *newrelic.Application) {
+	app.Shutdown(5 * time.Second)
+}
+
+func (tc *testCollector) events(t *testing.T, method string) []harvestedEvent {
+	t.Helper()
+	return tc.Events(t, method)
+}
+
+// transactionEvents harvests the application and returns the reported
+// transaction events.
+func (tc *testCollector) transactionEvents(t *testing.T, app *newrelic.Application) []harvestedEvent {
+	t.Helper()
+	tc.harvest(app)
+	return tc.events(t, "analytic_event_data")
+}
+
+// errorEvents harvests the application and returns the reported error events.
+func (tc *testCollector) errorEvents(t *testing.T, app *newrelic.Application) []harvestedEvent {
+	t.Helper()
+	tc.harvest(app)
+	return tc.events(t, "error_event_data")
+}
+
+// metrics harvests the application and returns the call count of every
+// reported metric, keyed by metric name.
+func (tc *testCollector) metrics(t *testing.T, app *newrelic.Application) map[string]float64 {
+	t.Helper()
+	return tc.metricData(t, app, 0)
+}
+
+// metricTotals harvests the application and returns the total value of every
+// reported metric, keyed by metric name.
+func (tc *testCollector) metricTotals(t *testing.T, app *newrelic.Application) map[string]float64 {
+	t.Helper()
+	return tc.metricData(t, app, 1)
+}
+
+// metricData returns the field at index of the data of every reported metric,
+// summed across harvests.
+func (tc *testCollector) metricData(t *testing.T, app *newrelic.Application, index int) map[string]float64 {
+	t.Helper()
+	tc.harvest(app)
+
+	metrics := map[string]float64{}
+	for _, payload := range tc.Payloads("metric_data") {
+		var data []json.RawMessage
+		require.NoError(t, json.Unmarshal(payload, &data))
+		require.Len(t, data, 4)
+
+		var raw [][]json.RawMessage
+		require.NoError(t, json.Unmarshal(data[3], &raw))
+
+		for _, metric := range raw {
+			var name struct {
+				Name string `json:"name"`
+			}
+			var values []float64
+			require.NoError(t, json.Unmarshal(metric[0], &name))
+			require.NoError(t, json.Unmarshal(metric[1], &values))
+			metrics[name.Name] += values[index]
+		}
+	}
+
+	return metrics
+}
+
+// findTransaction returns the transaction event with the given name, e.g.
+// "GET /users".
+func findTransaction(t *testing.T, events []harvestedEvent, name string) harvestedEvent {
+	t.Helper()
+
+	for _, event := range events {
+		if event.Intrinsics["name"] == "WebTransaction/Go/"+name {
+			return event
+		}
+	}
+
+	require.Failf(t, "transaction not found", "no transaction named %q", name)
+	return harvestedEvent{}
+}
+
+// customEvents harvests the application and returns the reported custom
+// events.
+func (tc *testCollector) customEvents(t *testing.T, app *newrelic.Application) []harvestedEvent {
+	t.Helper()
+	tc.harvest(app)
+	return tc.events(t, "custom_event_data")
+}
@@ -0,0 +1,118 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+const (
+	// newrelicHeader is the header of the New Relic distributed trace payload.
+	newrelicHeader = "newrelic"
+	// traceparentHeader is the header of the W3C trace context.
+	traceparentHeader = "traceparent"
+	// requestIDLocalsKey is the default fiber.Ctx locals key of the ID set by
+	// Fiber's requestid middleware.
+	requestIDLocalsKey = "requestid"
+)
+
+// traceparentPattern matches a W3C traceparent value.
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// acceptInboundHeaders accepts the New Relic distributed trace payload from
+// the first of the configured alternative headers present on the request.
+func acceptInboundHeaders(c *fiber.Ctx, txn *newrelic.Transaction, headers []string, transportType newrelic.TransportType) {
+	for _, name := range headers {
+		if value := c.Get(name); value != "" {
+			hdrs := http.Header{}
+			hdrs.Set(newrelicHeader, value)
+			txn.AcceptDistributedTraceHeaders(transportType, hdrs)
+
+			return
+		}
+	}
+}
+
+// writeOutboundHeader writes the New Relic distributed trace payload of the
+// transaction into the given response header.
+func writeOutboundHeader(c *fiber.Ctx, txn *newrelic.Transaction, header string) {
+	hdrs := http.Header{}
+	txn.InsertDistributedTraceHeaders(hdrs)
+
+	if value := hdrs.Get(newrelicHeader); value != "" {
+		c.Set(header, value)
+	}
+}
+
+// formatTraceparent formats the trace metadata of a transaction as a W3C
+// traceparent value.
+func formatTraceparent(md newrelic.TraceMetadata) string {
+	return "00-" + md.TraceID + "-" + md.SpanID + "-01"
+}
+
+// writeTraceparentHeader writes the W3C traceparent of the transaction into
+// the given response header.
+func writeTraceparentHeader(c *fiber.Ctx, txn *newrelic.Transaction, header string) {
+	if md := txn.GetTraceMetadata(); md.TraceID != "" && md.SpanID != "" {
+		c.Set(header, formatTraceparent(md))
+	}
+}
+
+// recordCorrelationID records the correlation ID sent in the given header.
+// A W3C traceparent value is also accepted as distributed trace context.
+func recordCorrelationID(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config, header string, transportType newrelic.TransportType) {
+	value := c.Get(header)
+	if value == "" {
+		return
+	}
+
+	addAttribute(txn, cfg, "request.correlationId", value)
+
+	if traceparentPattern.MatchString(value) {
+		hdrs := http.Header{}
+		hdrs.Set(traceparentHeader, value)
+		txn.AcceptDistributedTraceHeaders(transportType, hdrs)
+	}
+}
+
+// tagWithRequestID records the ID set by Fiber's requestid middleware, so the
+// transactions of the request can be joined with the request ID. The ID is
+// also added to the outgoing requests, see outboundRequestID.
+func tagWithRequestID(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config) {
+	if id := RequestID(c); id != "" {
+		addAttribute(txn, cfg, "request.id", id)
+	}
+}
+
+// outboundRequestID returns the request ID to send in the X-Request-ID header
+// of the outgoing requests with Config.TagAllWithRequestID, so an instrumented
+// downstream service using the requestid middleware records the same ID. It
+// returns "" when there is none.
+func outboundRequestID(c *fiber.Ctx, cfg *Config) string {
+	if cfg == nil || !cfg.TagAllWithRequestID {
+		return ""
+	}
+
+	return RequestID(c)
+}
+
+// RequestID returns the ID set by Fiber's requestid middleware for the current
+// request, and "" when the middleware did not run.
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDLocalsKey).(string)
+
+	return id
+}
+
+// TraceID returns the distributed trace ID of the transaction of the current
+// request, and "" when the request is not instrumented.
+func TraceID(c *fiber.Ctx) string {
+	txn, _ := transactionFromContext(c)
+	if txn == nil {
+		return ""
+	}
+
+	return txn.GetTraceMetadata().TraceID
+}
@@ -0,0 +1,419 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// upstreamHeaders returns the distributed trace headers of an upstream
+// transaction, along with its trace ID.
+func upstreamHeaders(t *testing.T, nrApp *newrelic.Application) (http.Header, string) {
+	t.Helper()
+
+	txn := nrApp.StartTransaction("upstream")
+	defer txn.End()
+
+	hdrs := http.Header{}
+	txn.InsertDistributedTraceHeaders(hdrs)
+	require.NotEmpty(t, hdrs.Get(newrelicHeader))
+
+	return hdrs, txn.GetTraceMetadata().TraceID
+}
+
+func TestDistributedTraceInboundHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		sendAs  string
+		linked  bool
+	}{
+		{name: "accepts payload from alternative header", headers: []string{"X-Gateway-Trace"}, sendAs: "X-Gateway-Trace", linked: true},
+		{name: "tries headers in order", headers: []string{"X-First", "X-Second"}, sendAs: "X-Second", linked: true},
+		{name: "ignores unknown headers", headers: []string{"X-Gateway-Trace"}, sendAs: "X-Other", linked: false},
+		{name: "ignores alternative headers when not configured", headers: nil, sendAs: "X-Gateway-Trace", linked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			hdrs, traceID := upstreamHeaders(t, nrApp)
+
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, DistributedTraceInboundHeaders: tt.headers}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(tt.sendAs, hdrs.Get(newrelicHeader))
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			if tt.linked {
+				assert.Equal(t, traceID, txn.Intrinsics["traceId"])
+			} else {
+				assert.NotEqual(t, traceID, txn.Intrinsics["traceId"])
+			}
+		})
+	}
+}
+
+func TestDistributedTraceOutboundHeader(t *testing.T) {
+	for _, header := range []string{"X-NR-Trace", ""} {
+		nrApp, _ := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, DistributedTraceOutboundHeader: header}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		if header != "" {
+			assert.NotEmpty(t, resp.Header.Get(header))
+		} else {
+			assert.Empty(t, resp.Header.Get("X-NR-Trace"))
+			assert.Empty(t, resp.Header.Get(newrelicHeader))
+		}
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		name   string
+		value  string
+		linked bool
+	}{
+		{name: "records the correlation ID", value: "req-42", linked: false},
+		{name: "accepts a W3C traceparent", value: "00-" + traceID + "-00f067aa0ba902b7-01", linked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, RequestIDHeader: "X-Correlation-ID"}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Correlation-ID", tt.value)
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, tt.value, txn.UserAttributes["request.correlationId"])
+			if tt.linked {
+				assert.Equal(t, traceID, txn.Intrinsics["traceId"])
+			} else {
+				assert.NotEqual(t, traceID, txn.Intrinsics["traceId"])
+			}
+		})
+	}
+}
+
+func TestTraceParentHeader(t *testing.T) {
+	for _, header := range []string{"X-Traceparent", ""} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, TraceParentHeader: header}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		if header == "" {
+			assert.Empty(t, resp.Header.Get("X-Traceparent"))
+			continue
+		}
+
+		value := resp.Header.Get(header)
+		assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, value)
+		assert.True(t, traceparentPattern.MatchString(value))
+
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+		assert.Equal(t, txn.Intrinsics["traceId"], value[3:35])
+	}
+}
+
+func TestInjectTraceparentInResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{name: "should write the default header", cfg: Config{InjectTraceparentInResponse: true}, expected: "X-Traceparent"},
+		{name: "should write the configured header", cfg: Config{InjectTraceparentInResponse: true, TraceparentResponseHeader: "X-Trace"}, expected: "X-Trace"},
+		{name: "should not write the header when disabled", cfg: Config{TraceparentResponseHeader: "X-Trace"}, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			tt.cfg.Application = nrApp
+			app := fiber.New()
+			app.Use(New(tt.cfg))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+
+			if tt.expected == "" {
+				assert.Empty(t, resp.Header.Get("X-Traceparent"))
+				assert.Empty(t, resp.Header.Get("X-Trace"))
+				return
+			}
+
+			value := resp.Header.Get(tt.expected)
+			assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, value)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, txn.Intrinsics["traceId"], value[3:35])
+		})
+	}
+}
+
+func TestTagAllWithRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		call func(ctx *fiber.Ctx, url string) error
+	}{
+		{
+			name: "should send the request ID with StartExternalSegment",
+			cfg:  Config{TagAllWithRequestID: true},
+			call: func(ctx *fiber.Ctx, url string) error {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				if err != nil {
+					return err
+				}
+				seg := StartExternalSegment(ctx, req)
+				defer seg.End()
+
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return err
+				}
+				return resp.Body.Close()
+			},
+		},
+		{
+			name: "should send the request ID with the wrapped FastHTTP client",
+			cfg:  Config{TagAllWithRequestID: true, HTTPClientWrapper: true},
+			call: func(ctx *fiber.Ctx, url string) error {
+				req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+				defer fasthttp.ReleaseRequest(req)
+				defer fasthttp.ReleaseResponse(resp)
+
+				req.SetRequestURI(url)
+				return WrapFastHTTPClient(ctx, &fasthttp.Client{}).Do(req, resp)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+
+			downstream := fiber.New()
+			downstream.Use(requestid.New())
+			downstream.Use(New(Config{Application: nrApp, TagAllWithRequestID: true, UseImmutableContext: true}))
+			downstream.Get("/payments", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+			server := httptest.NewServer(adaptor.FiberApp(downstream))
+			defer server.Close()
+
+			cfg := tt.cfg
+			cfg.Application = nrApp
+			upstream := fiber.New()
+			upstream.Use(requestid.New(requestid.Config{Generator: func() string { return "req-42" }}))
+			upstream.Use(New(cfg))
+			upstream.Get("/orders", func(ctx *fiber.Ctx) error {
+				if err := tt.call(ctx, server.URL+"/payments"); err != nil {
+					return err
+				}
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			resp, err := upstream.Test(httptest.NewRequest(http.MethodGet, "/orders", nil), -1)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			for _, header := range []string{newrelicHeader, traceparentHeader, tracestateHeader} {
+				assert.Empty(t, resp.Header.Get(header))
+			}
+
+			txns := collector.transactionEvents(t, nrApp)
+			orders := findTransaction(t, txns, "GET /orders")
+			payments := findTransaction(t, txns, "GET /payments")
+			assert.Equal(t, "req-42", orders.UserAttributes["request.id"])
+			assert.Equal(t, "req-42", payments.UserAttributes["request.id"])
+			assert.Equal(t, orders.Intrinsics["traceId"], payments.Intrinsics["traceId"])
+		})
+	}
+}
+
+func TestUseTraceID(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		sendHeader string
+		// traceparent sends the upstream traceparent instead of the newrelic payload.
+		traceparent bool
+		invalid     bool
+		named       bool
+	}{
+		{name: "should name after the trace ID of the newrelic header", cfg: Config{UseTraceID: true, UseImmutableContext: true}, sendHeader: newrelicHeader, named: true},
+		{name: "should name after the trace ID of the propagated trace context", cfg: Config{UseTraceID: true, TraceContextPropagation: PropagationW3C}, sendHeader: traceparentHeader, traceparent: true, named: true},
+		{name: "should name after the trace ID of an alternative header", cfg: Config{UseTraceID: true, DistributedTraceInboundHeaders: []string{"X-Gateway-Trace"}}, sendHeader: "X-Gateway-Trace", named: true},
+		{name: "should name after the trace ID of the request ID header", cfg: Config{UseTraceID: true, RequestIDHeader: "X-Request-Id"}, sendHeader: "X-Request-Id", traceparent: true, named: true},
+		{name: "should take precedence over the route path", cfg: Config{UseTraceID: true, UseRoutePath: true, UseImmutableContext: true}, sendHeader: newrelicHeader, named: true},
+		{name: "should keep the name of new traces", cfg: Config{UseTraceID: true, UseImmutableContext: true}, named: false},
+		{name: "should keep the name with an invalid newrelic header", cfg: Config{UseTraceID: true, UseImmutableContext: true}, sendHeader: newrelicHeader, invalid: true, named: false},
+		{name: "should keep the name with an invalid traceparent", cfg: Config{UseTraceID: true, TraceContextPropagation: PropagationW3C}, sendHeader: traceparentHeader, invalid: true, named: false},
+		{name: "should keep the name with an invalid request ID header", cfg: Config{UseTraceID: true, RequestIDHeader: "X-Request-Id"}, sendHeader: "X-Request-Id", invalid: true, named: false},
+		{name: "should keep the name when disabled", cfg: Config{UseImmutableContext: true}, sendHeader: newrelicHeader, named: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			hdrs, traceID := upstreamHeaders(t, nrApp)
+
+			cfg := tt.cfg
+			cfg.Application = nrApp
+			app := fiber.New()
+			app.Use(New(cfg))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sendHeader != "" {
+				value := hdrs.Get(newrelicHeader)
+				if tt.traceparent {
+					value = hdrs.Get(traceparentHeader)
+				}
+				if tt.invalid {
+					value = "garbage"
+				}
+				req.Header.Set(tt.sendHeader, value)
+			}
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			events := collector.transactionEvents(t, nrApp)
+			if tt.named {
+				txn := findTransaction(t, events, traceID)
+				assert.Equal(t, traceID, txn.Intrinsics["traceId"])
+			} else {
+				findTransaction(t, events, "GET /")
+			}
+		})
+	}
+}
+
+func TestRecordFiberRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID bool
+		expected  string
+	}{
+		{name: "should record the request ID", requestID: true, expected: "req-42"},
+		{name: "should skip the request ID without the requestid middleware", requestID: false, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			if tt.requestID {
+				app.Use(requestid.New(requestid.Config{Generator: func() string { return "req-42" }}))
+			}
+			app.Use(New(Config{Application: nrApp, RecordFiberRequestID: true}))
+
+			var requestID, traceID string
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				requestID, traceID = RequestID(ctx), TraceID(ctx)
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			require.NoError(t, err)
+			assert.Empty(t, resp.Header.Get(traceparentHeader))
+			assert.Equal(t, tt.expected, requestID)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.NotEmpty(t, traceID)
+			assert.Equal(t, txn.Intrinsics["traceId"], traceID)
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, txn.UserAttributes["request.id"])
+			} else {
+				assert.NotContains(t, txn.UserAttributes, "request.id")
+			}
+		})
+	}
+}
+
+func TestTraceIDWithoutTransaction(t *testing.T) {
+	// given
+	app := fiber.New()
+
+	var traceID string
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		traceID = TraceID(ctx)
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	require.NoError(t, err)
+	assert.Empty(t, traceID)
+}
@@ -0,0 +1,100 @@
+package fibernewrelic
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// drainSignals are the signals that trigger a drain of the New Relic
+// applications.
+var drainSignals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+
+// notifySignals, stopSignals and raiseSignal are replaced in tests.
+var (
+	notifySignals = signal.Notify
+	stopSignals   = signal.Stop
+	raiseSignal   = func(sig os.Signal) {
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			_ = p.Signal(sig)
+		}
+	}
+)
+
+// drainEnabled reports whether the applications created for cfg are drained
+// on signal.
+func drainEnabled(cfg *Config) bool {
+	return cfg.DrainTimeout > 0 && (cfg.SignalDrainEnabled == nil || *cfg.SignalDrainEnabled)
+}
+
+// appDrainer shuts down every registered application on the first drain
+// signal, with a single signal listener for the process.
+type appDrainer struct {
+	mu        sync.Mutex
+	apps      map[*newrelic.Application]time.Duration
+	listening bool
+}
+
+// drainer is the process wide appDrainer, replaced in tests.
+var drainer = newAppDrainer()
+
+func newAppDrainer() *appDrainer {
+	return &appDrainer{apps: make(map[*newrelic.Application]time.Duration)}
+}
+
+// register adds app to the applications shut down on the first drain signal,
+// flushing pending data for at most timeout. The signal listener is started
+// with the first registered application.
+func (d *appDrainer) register(app *newrelic.Application, timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.apps[app] = timeout
+	if d.listening {
+		return
+	}
+	d.listening = true
+
+	signals := make(chan os.Signal, 1)
+	notifySignals(signals, drainSignals...)
+	go d.drainOnSignal(signals)
+}
+
+// unregister removes app, e.g. once it was shut down.
+func (d *appDrainer) unregister(app *newrelic.Application) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.apps, app)
+}
+
+// drainOnSignal shuts the registered applications down in parallel once the
+// first drain signal is received. The signal is then raised again, once, so
+// the default behaviour of the process, or the shutdown handling of the Fiber
+// app, still applies.
+func (d *appDrainer) drainOnSignal(signals chan os.Signal) {
+	sig := <-signals
+	stopSignals(signals)
+
+	d.mu.Lock()
+	apps := d.apps
+	d.apps = make(map[*newrelic.Application]time.Duration)
+	d.listening = false
+	d.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for app, timeout := range apps {
+		wg.Add(1)
+		go func(app *newrelic.Application, timeout time.Duration) {
+			defer wg.Done()
+			app.Shutdown(timeout)
+		}(app, timeout)
+	}
+	wg.Wait()
+
+	raiseSignal(sig)
+}
@@ -0,0 +1,109 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubSignals replaces the signal functions for the duration of the test and
+// returns the channels registered for drain signals.
+func stubSignals(t *testing.T) (registered chan chan<- os.Signal, raised chan os.Signal) {
+	registered = make(chan chan<- os.Signal, 4)
+	raised = make(chan os.Signal, 4)
+
+	notify, stop, raise, d := notifySignals, stopSignals, raiseSignal, drainer
+	t.Cleanup(func() {
+		notifySignals, stopSignals, raiseSignal, drainer = notify, stop, raise, d
+	})
+	drainer = newAppDrainer()
+
+	notifySignals = func(c chan<- os.Signal, sig ...os.Signal) { registered <- c }
+	stopSignals = func(c chan<- os.Signal) {}
+	raiseSignal = func(sig os.Signal) { raised <- sig }
+
+	return registered, raised
+}
+
+func TestDrainTimeout(t *testing.T) {
+	t.Run("should shut the application down on signal", func(t *testing.T) {
+		// given
+		registered, raised := stubSignals(t)
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, DrainTimeout: 5 * time.Second}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		// when
+		(<-registered) <- syscall.SIGTERM
+
+		// then
+		select {
+		case sig := <-raised:
+			assert.Equal(t, syscall.SIGTERM, sig)
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal was not raised again")
+		}
+		assert.Len(t, collector.events(t, "analytic_event_data"), 1)
+	})
+
+	t.Run("should shut every application down with one listener", func(t *testing.T) {
+		// given
+		registered, raised := stubSignals(t)
+		firstApp, firstCollector := newTestApplication(t)
+		secondApp, secondCollector := newTestApplication(t)
+		secondaryApp, secondaryCollector := newTestApplication(t)
+
+		app := fiber.New()
+		app.Use(New(Config{Application: firstApp, DrainTimeout: 5 * time.Second}))
+		app.Use(NewMultiApp(
+			Config{Application: secondApp, Namespace: "second", DrainTimeout: 5 * time.Second},
+			Config{Application: secondaryApp},
+		))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		// when
+		listener := <-registered
+		assert.Len(t, registered, 0)
+		listener <- syscall.SIGTERM
+
+		// then
+		select {
+		case sig := <-raised:
+			assert.Equal(t, syscall.SIGTERM, sig)
+		case <-time.After(5 * time.Second):
+			t.Fatal("signal was not raised again")
+		}
+		assert.Len(t, raised, 0)
+		assert.Len(t, firstCollector.events(t, "analytic_event_data"), 1)
+		assert.Len(t, secondCollector.events(t, "analytic_event_data"), 1)
+		assert.Len(t, secondaryCollector.events(t, "analytic_event_data"), 1)
+	})
+
+	t.Run("should not listen when disabled", func(t *testing.T) {
+		registered, _ := stubSignals(t)
+		disabled := false
+
+		nrApp, _ := newTestApplication(t)
+		New(Config{Application: nrApp, DrainTimeout: time.Second, SignalDrainEnabled: &disabled})
+		New(Config{Application: nrApp})
+
+		assert.Len(t, registered, 0)
+	})
+}
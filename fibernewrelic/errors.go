@@ -0,0 +1,188 @@
+package fibernewrelic
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// NoticeError notices err on the transaction of the current request, honouring
+// Config.MaxErrorsPerRequest. It is a no-op when the request is not
+// instrumented.
+func NoticeError(c *fiber.Ctx, err error) {
+	state := getRequestState(c)
+	if state == nil {
+		return
+	}
+
+	state.noticeError(err)
+}
+
+// shouldReportError makes the per-request decision whether an error is
+// reported, based on the configured error sampling rate.
+func shouldReportError(rate *float64) bool {
+	if rate == nil || *rate >= 1 {
+		return true
+	}
+
+	if *rate <= 0 {
+		return false
+	}
+
+	// The top-level math/rand functions are safe for concurrent use.
+	return rand.Float64() < *rate
+}
+
+// errorAttributer is implemented by errors carrying their own New Relic error
+// attributes, such as newrelic.Error.
+type errorAttributer interface {
+	ErrorAttributes() map[string]interface{}
+}
+
+// attributedError adds static attributes to the error event of the wrapped
+// error. Class and stack trace still come from the wrapped error.
+type attributedError struct {
+	error
+	attributes map[string]interface{}
+}
+
+// withErrorAttributes wraps err so its error event carries attributes. The
+// attributes of an err implementing ErrorAttributes take precedence.
+func withErrorAttributes(err error, attributes map[string]interface{}) error {
+	if len(attributes) == 0 {
+		return err
+	}
+
+	return attributedError{error: err, attributes: attributes}
+}
+
+func (e attributedError) Unwrap() error {
+	return e.error
+}
+
+func (e attributedError) ErrorAttributes() map[string]interface{} {
+	attrs := make(map[string]interface{}, len(e.attributes))
+	for key, value := range e.attributes {
+		attrs[key] = value
+	}
+
+	if attributer, ok := e.error.(errorAttributer); ok {
+		for key, value := range attributer.ErrorAttributes() {
+			attrs[key] = value
+		}
+	}
+
+	return attrs
+}
+
+// rewrittenError replaces the message of the wrapped error. Class, stack trace
+// and attributes still come from the wrapped error.
+type rewrittenError struct {
+	error
+	message string
+}
+
+func (e rewrittenError) Error() string {
+	return e.message
+}
+
+func (e rewrittenError) Unwrap() error {
+	return e.error
+}
+
+func (e rewrittenError) ErrorAttributes() map[string]interface{} {
+	if attributer, ok := e.error.(errorAttributer); ok {
+		return attributer.ErrorAttributes()
+	}
+
+	return nil
+}
+
+// rewriteErrorMessage applies Config.ErrorMessageRewriter to err.
+func rewriteErrorMessage(err error, cfg *Config) error {
+	if !cfg.RewriteErrorMessages || cfg.ErrorMessageRewriter == nil {
+		return err
+	}
+
+	return rewrittenError{error: err, message: cfg.ErrorMessageRewriter(err)}
+}
+
+// TruncatingRewriter returns an ErrorMessageRewriter which truncates error
+// messages longer than maxLen bytes and appends "...".
+func TruncatingRewriter(maxLen int) func(err error) string {
+	return func(err error) string {
+		return truncateString(err.Error(), maxLen)
+	}
+}
+
+// chainErrorStatusCodeHandlers returns an ErrorStatusCodeHandler returning the
+// first non-zero status code of handlers, falling back to
+// DefaultErrorStatusCodeHandler.
+func chainErrorStatusCodeHandlers(handlers []func(c *fiber.Ctx, err error) int) func(c *fiber.Ctx, err error) int {
+	return func(c *fiber.Ctx, err error) int {
+		for _, handler := range handlers {
+			if handler == nil {
+				continue
+			}
+
+			if statusCode := handler(c, err); statusCode != 0 {
+				return statusCode
+			}
+		}
+
+		return DefaultErrorStatusCodeHandler(c, err)
+	}
+}
+
+// logTransactionError logs an error noticed on txn to Config.LogOutput, or
+// with the Fiber logger when it is nil.
+func logTransactionError(cfg *Config, txn *newrelic.Transaction, err error) {
+	if cfg.LogOutput == nil {
+		log.Errorf("fibernewrelic: error in transaction %q: %v", txn.Name(), err)
+		return
+	}
+
+	_, _ = fmt.Fprintf(cfg.LogOutput, "fibernewrelic: error in transaction %q: %v\n", txn.Name(), err)
+}
+
+// errorLogLine is the JSON log line written by Config.AutoLinkLogsOnError,
+// with the linking metadata keys of the New Relic logs in context.
+type errorLogLine struct {
+	Message    string `json:"message"`
+	TraceID    string `json:"trace.id,omitempty"`
+	SpanID     string `json:"span.id,omitempty"`
+	EntityName string `json:"entity.name,omitempty"`
+	EntityType string `json:"entity.type,omitempty"`
+	EntityGUID string `json:"entity.guid,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+}
+
+// logErrorLinkingMetadata writes err with the linking metadata of txn as a
+// JSON line to Config.LogOutput, or to stderr when it is nil.
+func logErrorLinkingMetadata(cfg *Config, txn *newrelic.Transaction, err error) {
+	md := txn.GetLinkingMetadata()
+	line, jsonErr := json.Marshal(errorLogLine{
+		Message:    err.Error(),
+		TraceID:    md.TraceID,
+		SpanID:     md.SpanID,
+		EntityName: md.EntityName,
+		EntityType: md.EntityType,
+		EntityGUID: md.EntityGUID,
+		Hostname:   md.Hostname,
+	})
+	if jsonErr != nil {
+		return
+	}
+
+	out := cfg.LogOutput
+	if out == nil {
+		out = os.Stderr
+	}
+
+	_, _ = out.Write(append(line, '\n'))
+}
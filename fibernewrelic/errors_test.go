@@ -0,0 +1,396 @@
+package fibernewrelic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorClasses returns the error classes of the given error events.
+func errorClasses(events []harvestedEvent) []interface{} {
+	classes := make([]interface{}, 0, len(events))
+	for _, event := range events {
+		classes = append(classes, event.Intrinsics["error.class"])
+	}
+
+	return classes
+}
+
+func TestShouldReportError(t *testing.T) {
+	rate := func(r float64) *float64 { return &r }
+
+	assert.True(t, shouldReportError(nil))
+	assert.True(t, shouldReportError(rate(1)))
+	assert.False(t, shouldReportError(rate(0)))
+	assert.False(t, shouldReportError(rate(-1)))
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, shouldReportError(rate(1.5)))
+	}
+}
+
+func TestErrorSamplingRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     *float64
+		reported bool
+	}{
+		{name: "all errors are reported by default", rate: nil, reported: true},
+		{name: "no errors are reported at rate 0", rate: new(float64), reported: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, ErrorSamplingRate: tt.rate}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return fiber.NewError(http.StatusInternalServerError, "system error")
+			})
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+			classes := errorClasses(collector.errorEvents(t, nrApp))
+			// the status code is reported in any case
+			assert.Contains(t, classes, "500")
+			if tt.reported {
+				assert.Contains(t, classes, "*fiber.Error")
+			} else {
+				assert.NotContains(t, classes, "*fiber.Error")
+			}
+		})
+	}
+}
+
+func TestErrorTransformer(t *testing.T) {
+	tests := []struct {
+		name        string
+		transformer func(err error) error
+		messages    []interface{}
+	}{
+		{
+			name:        "should report the rewritten error",
+			transformer: func(err error) error { return errors.New("scrubbed") },
+			messages:    []interface{}{"scrubbed"},
+		},
+		{
+			name:        "should suppress the error when nil is returned",
+			transformer: func(err error) error { return nil },
+			messages:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, ErrorTransformer: tt.transformer}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return fiber.NewError(http.StatusInternalServerError, "password=secret")
+			})
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+			var messages []interface{}
+			events := collector.errorEvents(t, nrApp)
+			for _, event := range events {
+				if event.Intrinsics["error.class"] != "500" {
+					messages = append(messages, event.Intrinsics["error.message"])
+				}
+			}
+			// the status code is reported in any case
+			assert.Contains(t, errorClasses(events), "500")
+			assert.Equal(t, tt.messages, messages)
+		})
+	}
+}
+
+// attributesError is an error with its own New Relic error attributes.
+type attributesError struct{}
+
+func (attributesError) Error() string { return "with attributes" }
+
+func (attributesError) ErrorAttributes() map[string]interface{} {
+	return map[string]interface{}{"team": "checkout", "order": "42"}
+}
+
+func TestNRErrorAttributes(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application:       nrApp,
+		NRErrorAttributes: map[string]interface{}{"team": "payments", "service": "api"},
+	}))
+	app.Get("/fiber", func(ctx *fiber.Ctx) error {
+		return fiber.NewError(http.StatusInternalServerError, "system error")
+	})
+	app.Get("/attributes", func(ctx *fiber.Ctx) error {
+		return attributesError{}
+	})
+
+	// when
+	for _, url := range []string{"/fiber", "/attributes"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	byClass := map[interface{}]harvestedEvent{}
+	for _, event := range collector.errorEvents(t, nrApp) {
+		byClass[event.Intrinsics["error.class"]] = event
+	}
+
+	if assert.Contains(t, byClass, "*fiber.Error") {
+		attrs := byClass["*fiber.Error"].UserAttributes
+		assert.Equal(t, "payments", attrs["team"])
+		assert.Equal(t, "api", attrs["service"])
+	}
+	if assert.Contains(t, byClass, "fibernewrelic.attributesError") {
+		attrs := byClass["fibernewrelic.attributesError"].UserAttributes
+		assert.Equal(t, "checkout", attrs["team"], "error attributes take precedence")
+		assert.Equal(t, "api", attrs["service"])
+		assert.Equal(t, "42", attrs["order"])
+	}
+}
+
+func TestErrorAttributes(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application: nrApp,
+		ErrorAttributes: func(c *fiber.Ctx, err error) map[string]interface{} {
+			return map[string]interface{}{"payment.id": c.Query("payment"), "error.reason": err.Error()}
+		},
+	}))
+	app.Get("/ok", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/fail", func(ctx *fiber.Ctx) error {
+		return fiber.NewError(http.StatusBadGateway, "upstream down")
+	})
+
+	// when
+	for _, url := range []string{"/ok?payment=1", "/fail?payment=2"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.NotContains(t, findTransaction(t, txns, "GET /ok").UserAttributes, "payment.id")
+
+	failed := findTransaction(t, txns, "GET /fail").UserAttributes
+	assert.Equal(t, "2", failed["payment.id"])
+	assert.Equal(t, "upstream down", failed["error.reason"])
+}
+
+func TestMaxErrorsPerRequest(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, MaxErrorsPerRequest: 2}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		for i := 0; i < 4; i++ {
+			NoticeError(ctx, errors.New("item failed"))
+		}
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+
+	// then
+	assert.Len(t, collector.errorEvents(t, nrApp), 2)
+
+	txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+	assert.Equal(t, true, txn.UserAttributes["nrMaxErrorsExceeded"])
+}
+
+func TestNoticeError(t *testing.T) {
+	t.Run("should notice the error on the transaction", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			NoticeError(ctx, errors.New("item failed"))
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		events := collector.errorEvents(t, nrApp)
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, "item failed", events[0].Intrinsics["error.message"])
+		}
+	})
+
+	t.Run("should be a no-op for requests which are not instrumented", func(t *testing.T) {
+		app := fiber.New()
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			NoticeError(ctx, errors.New("item failed"))
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestRewriteErrorMessages(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application:          nrApp,
+		RewriteErrorMessages: true,
+		ErrorMessageRewriter: TruncatingRewriter(8),
+		NRErrorAttributes:    map[string]interface{}{"team": "payments"},
+	}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return fiber.NewError(http.StatusInternalServerError, "connection refused at 0xc000123456")
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+
+	// then
+	byClass := map[interface{}]harvestedEvent{}
+	for _, event := range collector.errorEvents(t, nrApp) {
+		byClass[event.Intrinsics["error.class"]] = event
+	}
+
+	if assert.Contains(t, byClass, "*fiber.Error") {
+		event := byClass["*fiber.Error"]
+		assert.Equal(t, "connecti...", event.Intrinsics["error.message"])
+		assert.Equal(t, "payments", event.UserAttributes["team"])
+	}
+}
+
+func TestTruncatingRewriter(t *testing.T) {
+	rewrite := TruncatingRewriter(5)
+
+	assert.Equal(t, "short", rewrite(errors.New("short")))
+	assert.Equal(t, "too l...", rewrite(errors.New("too long")))
+}
+
+func TestMultipleErrorHandlers(t *testing.T) {
+	t.Run("should use the first non-zero status code", func(t *testing.T) {
+		// given
+		var calls []string
+		handler := func(name string, statusCode int) func(*fiber.Ctx, error) int {
+			return func(*fiber.Ctx, error) int {
+				calls = append(calls, name)
+				return statusCode
+			}
+		}
+
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{
+			Application: nrApp,
+			MultipleErrorHandlers: []func(*fiber.Ctx, error) int{
+				handler("zero", 0),
+				nil,
+				handler("teapot", http.StatusTeapot),
+				handler("unavailable", http.StatusServiceUnavailable),
+			},
+		}))
+		app.Get("/", func(ctx *fiber.Ctx) error { return errors.New("system error") })
+
+		// when
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		// then
+		assert.Equal(t, []string{"zero", "teapot"}, calls)
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+		assert.Equal(t, float64(http.StatusTeapot), txn.AgentAttributes["http.statusCode"])
+	})
+
+	t.Run("should fall back to DefaultErrorStatusCodeHandler", func(t *testing.T) {
+		chain := chainErrorStatusCodeHandlers([]func(*fiber.Ctx, error) int{
+			func(*fiber.Ctx, error) int { return 0 },
+		})
+
+		assert.Equal(t, http.StatusNotFound, chain(nil, fiber.ErrNotFound))
+	})
+}
+
+func TestLogTransactionErrors(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	nrApp, _ := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, LogTransactionErrors: true, LogOutput: &output}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return fiber.NewError(http.StatusBadGateway, "upstream unavailable")
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "fibernewrelic: error in transaction \"GET /\": upstream unavailable\n", output.String())
+}
+
+func TestAutoLinkLogsOnError(t *testing.T) {
+	// given
+	var output bytes.Buffer
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, AutoLinkLogsOnError: true, LogOutput: &output}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return fiber.NewError(http.StatusBadGateway, "upstream unavailable")
+	})
+	app.Get("/ok", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+	_, err = app.Test(httptest.NewRequest(http.MethodGet, "/ok", nil), -1)
+	assert.NoError(t, err)
+
+	// then
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	require.Len(t, lines, 1)
+
+	var line map[string]string
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+
+	txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+	assert.Equal(t, "upstream unavailable", line["message"])
+	assert.Equal(t, txn.Intrinsics["traceId"], line["trace.id"])
+	assert.NotEmpty(t, line["span.id"])
+	assert.Equal(t, "fibernewrelic-test", line["entity.name"])
+	assert.Equal(t, "SERVICE", line["entity.type"])
+	assert.NotEmpty(t, line["hostname"])
+}
@@ -1,15 +1,29 @@
 package fibernewrelic
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2/utils"
-	"net/url"
+	"io"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
+const (
+	// CategoryWeb reports requests as web transactions.
+	CategoryWeb = "web"
+	// CategoryBackground reports requests as background transactions.
+	CategoryBackground = "background"
+)
+
 type Config struct {
 	// License parameter is required to initialize newrelic application
 	License string
@@ -28,100 +42,1614 @@ type Config struct {
 	// Next defines a function to skip this middleware when returned true.
 	// Optional. Default: nil
 	Next func(c *fiber.Ctx) bool
+	// UseRoutePath names transactions after the matched route pattern (e.g. /users/:id)
+	// instead of the raw request path. Requests matching no route are named
+	// "<METHOD> (not found)"
+	// Optional. Default: false
+	UseRoutePath bool
+	// RouteGroupSeparator is inserted between the route group prefix and the rest of the
+	// route path in transaction names. Only applied when UseRoutePath is true
+	// Optional. Default: ""
+	RouteGroupSeparator string
+	// MaxAttributeValueLength truncates string attribute values longer than this many bytes
+	// and appends "...". Zero means no limit
+	// Optional. Default: 0
+	MaxAttributeValueLength int
+	// RecordGoroutineCount records the number of goroutines at the start of the request
+	// as runtime.goroutines, along with the runtime.cpuCount attribute
+	// Optional. Default: false
+	RecordGoroutineCount bool
+	// RecordMemStats records a runtime.MemStats snapshot as the mem.alloc, mem.heapSys,
+	// mem.numGC and mem.pauseTotalNs attributes
+	// Optional. Default: false
+	RecordMemStats bool
+	// MemStatsInterval is the minimum time between two runtime.MemStats snapshots. Requests
+	// within the interval reuse the cached snapshot. Zero reads the stats on every request
+	// Optional. Default: 0
+	MemStatsInterval time.Duration
+	// RecordRouteHandlerCount records the number of handlers of the matched route as
+	// fiber.handlerCount
+	// Optional. Default: false
+	RecordRouteHandlerCount bool
+	// Hooks defines callbacks which are executed when a transaction starts and ends.
+	// Panics in hooks are recovered and logged
+	// Optional. Default: Hooks{}
+	Hooks Hooks
+	// DistributedTraceInboundHeaders lists alternative request headers which may carry the
+	// New Relic distributed trace payload. The first header present is accepted
+	// Optional. Default: nil
+	DistributedTraceInboundHeaders []string
+	// DistributedTraceOutboundHeader is the response header the New Relic distributed trace
+	// payload is written to. Empty does not expose the payload
+	// Optional. Default: ""
+	DistributedTraceOutboundHeader string
+	// UseImmutableContext captures all request fields reported to New Relic, including the
+	// request headers, before calling the next handler. Use it when handlers keep a reference
+	// to the fiber.Ctx for asynchronous work. With the request headers, the agent also accepts
+	// the newrelic and W3C distributed trace headers of the request and records its
+	// request.headers.* attributes, e.g. request.headers.userAgent
+	// Optional. Default: false
+	UseImmutableContext bool
+	// MetricsPrefix is prepended to the name of every custom metric recorded by this package
+	// Optional. Default: ""
+	MetricsPrefix string
+	// ErrorSamplingRate is the fraction (0.0 - 1.0) of handler errors reported to New Relic.
+	// The status code is reported regardless of the sampling decision. Nil reports all errors
+	// Optional. Default: nil
+	ErrorSamplingRate *float64
+	// FiberVersionAttribute records the Fiber framework version as fiber.version on every
+	// transaction
+	// Optional. Default: false
+	FiberVersionAttribute bool
+	// FiberVersionAsEvent records the Fiber version once, as a FiberVersion custom event,
+	// instead of as an attribute on every transaction. Only applied when FiberVersionAttribute
+	// is true
+	// Optional. Default: false
+	FiberVersionAsEvent bool
+	// RecoverPanics reports panics raised by the next handlers to New Relic, along with their
+	// stack trace. The panic is raised again after it has been reported
+	// Optional. Default: false
+	RecoverPanics bool
+	// PanicStackDepth is the maximum number of stack frames captured for a recovered panic
+	// Optional. Default: 32
+	PanicStackDepth int
+	// PanicNotifyOnce only reports the first occurrence of each unique panic stack trace
+	// to New Relic. Repeated panics still respond with 500 Internal Server Error.
+	// Only applied when RecoverPanics or GracefulPanicRecover is true
+	// Optional. Default: false
+	PanicNotifyOnce bool
+	// PanicDeduplicationTTL is the duration after which an already reported panic stack
+	// trace is reported again. Zero keeps deduplicated panics for the application lifetime.
+	// Only applied when PanicNotifyOnce is true
+	// Optional. Default: 0
+	PanicDeduplicationTTL time.Duration
+	// TransactionTimeout cancels the user context of requests running longer than this
+	// duration. Timed out requests are reported to New Relic and respond with
+	// 408 Request Timeout. Zero disables the timeout
+	// Optional. Default: 0
+	TransactionTimeout time.Duration
+	// SpanNameFormatter overrides the name of segments created by the package helpers. It
+	// receives a *newrelic.Segment, *newrelic.DatastoreSegment, *newrelic.ExternalSegment or
+	// *newrelic.MessageProducerSegment and returns the new name, or "" to keep the name.
+	// The name replaces Segment.Name, DatastoreSegment.Operation, ExternalSegment.Procedure
+	// and MessageProducerSegment.DestinationName respectively
+	// Optional. Default: nil
+	SpanNameFormatter func(segment interface{}) string
+	// TransactionNameCacheSize is the number of route based transaction names kept in an LRU
+	// cache, keyed by method and route pattern. Only applied when UseRoutePath is true.
+	// Zero disables the cache
+	// Optional. Default: 0
+	TransactionNameCacheSize int
+	// UserIDExtractor returns the ID of the authenticated user, recorded with txn.SetUserID.
+	// It is called after the next handlers so authentication middleware has run. Empty IDs
+	// are ignored
+	// Optional. Default: nil
+	UserIDExtractor func(c *fiber.Ctx) string
+	// MaxBodySegmentSize is the largest request body, in bytes, instrumented by ParseBody.
+	// Larger bodies are parsed without a segment and record request.bodyTruncated instead.
+	// A negative value disables the limit
+	// Optional. Default: 65536
+	MaxBodySegmentSize int64
+	// ErrorTransformer rewrites handler errors before they are reported to New Relic.
+	// Returning nil suppresses the error, the status code is still reported
+	// Optional. Default: nil
+	ErrorTransformer func(err error) error
+	// CustomAttributes are added to every transaction
+	// Optional. Default: nil
+	CustomAttributes map[string]interface{}
+	// TagsFromEnvironment is a list of environment variables read once in New and added to
+	// CustomAttributes as "env.<NAME>". Unset variables are skipped
+	// Optional. Default: nil
+	TagsFromEnvironment []string
+	// DrainTimeout shuts the New Relic application down on SIGTERM or SIGINT, flushing pending
+	// data for at most this duration. This is additive to the shutdown handling of the Fiber
+	// app. The applications of every middleware, of NewMultiApp and of NRApplicationName are
+	// drained by a single listener, which raises the signal again once. Zero disables the
+	// drain
+	// Optional. Default: 0
+	DrainTimeout time.Duration
+	// SignalDrainEnabled enables the signal listener used by DrainTimeout
+	// Optional. Default: true
+	SignalDrainEnabled *bool
+	// SuppressEmptyTransactions ignores transactions of requests whose last reached route has
+	// fewer than MinHandlersForTransaction handlers, such as CORS preflight or cache middleware
+	// routes. A request that never reaches another route than this middleware's counts as
+	// zero handlers
+	// Optional. Default: false
+	SuppressEmptyTransactions bool
+	// MinHandlersForTransaction is the number of route handlers required for a transaction to
+	// be reported. Only applied when SuppressEmptyTransactions is true
+	// Optional. Default: 1
+	MinHandlersForTransaction int
+	// RequestIDHeader is the header of a correlation ID set by a gateway, recorded as
+	// request.correlationId. A W3C traceparent value is also accepted as distributed
+	// trace context
+	// Optional. Default: ""
+	RequestIDHeader string
+	// HTTPClientWrapper reports the requests of clients wrapped with WrapFastHTTPClient as
+	// external segments
+	// Optional. Default: false
+	HTTPClientWrapper bool
+	// CaptureRequestBody records up to MaxCapturedBodyBytes of the raw request body as
+	// request.body when the response status is 500 or above. Compressed bodies are recorded
+	// as received, without being decoded, and streamed bodies are not recorded. Request bodies may contain
+	// passwords, tokens and personal data; enabling this sends them to New Relic
+	// Optional. Default: false
+	CaptureRequestBody bool
+	// MaxCapturedBodyBytes is the maximum number of request body bytes recorded by
+	// CaptureRequestBody
+	// Optional. Default: 4096
+	MaxCapturedBodyBytes int
+	// NRErrorAttributes are added to every error event reported by the middleware, such as
+	// the owning team to route alerts
+	// Optional. Default: nil
+	NRErrorAttributes map[string]interface{}
+	// PostTransactionHook is called synchronously once the transaction has ended, before the
+	// middleware returns, e.g. to log txn.GetLinkingMetadata(). Panics are recovered and logged
+	// Optional. Default: nil
+	PostTransactionHook func(txn *newrelic.Transaction, c *fiber.Ctx)
+	// BodyParserSegmentName is the name of the segment created by ParseBody
+	// Optional. Default: "request/body-parsing"
+	BodyParserSegmentName string
+	// PropagateUserContext keeps the values of the user context set by previous middleware
+	// when the transaction is added to it. When false, the transaction is added to an
+	// empty context
+	// Optional. Default: true
+	PropagateUserContext *bool
+	// LimitConcurrentTransactions caps the number of requests instrumented at the same time.
+	// Requests above the limit are served without a transaction and counted in the
+	// Custom/FibernewrelicSkipped metric. Zero disables the limit
+	// Optional. Default: 0
+	LimitConcurrentTransactions int
+	// NRApplicationName returns the name of the New Relic application the request is reported
+	// to, e.g. one per tenant. Applications are created on first use from License, which is
+	// required, and Enabled. An empty name, or a name whose application can not be created,
+	// reports to the default application
+	// Optional. Default: nil
+	NRApplicationName func(c *fiber.Ctx) string
+	// ApplicationCacheTTL is the duration after which an application created for
+	// NRApplicationName is created again. The previous one is shut down once its in-flight
+	// transactions ended, and the expired ones are also shut down whenever another
+	// application is created. Zero keeps applications forever
+	// Optional. Default: 0
+	ApplicationCacheTTL time.Duration
+	// ApplicationCacheSize is the maximum number of applications created for
+	// NRApplicationName. Once reached, the application created first is shut down, like
+	// the expired ones, before another one is created
+	// Optional. Default: 100
+	ApplicationCacheSize int
+	// RecordHTTPVersion records the HTTP protocol version of the request, e.g. "HTTP/1.1",
+	// as request.protocol
+	// Optional. Default: false
+	RecordHTTPVersion bool
+	// RecordTLSInfo records the TLS version and cipher suite of the connection as tls.version
+	// and tls.cipherSuite. Plain connections record tls.version "none"
+	// Optional. Default: false
+	RecordTLSInfo bool
+	// RecordHostname records the host name of the server, read once in New, as
+	// server.hostname on every transaction
+	// Optional. Default: false
+	RecordHostname bool
+	// ErrorAttributes returns attributes added to the transaction when a handler returns an
+	// error, e.g. to attach request scoped context only to failed requests
+	// Optional. Default: nil
+	ErrorAttributes func(c *fiber.Ctx, err error) map[string]interface{}
+	// SkipSuccessfulTransactions ignores transactions with a 2xx response status code, so only
+	// failed requests are reported
+	// Optional. Default: false
+	SkipSuccessfulTransactions bool
+	// TraceParentHeader is the response header the W3C traceparent of the transaction is
+	// written to, e.g. for browser side log correlation
+	// Optional. Default: ""
+	TraceParentHeader string
+	// EventHarvest configures the event harvest of the New Relic application. Only applied
+	// when the application is created by the middleware
+	// Optional. Default: EventHarvest{}
+	EventHarvest EventHarvest
+	// CustomMetricsFromRequest returns custom metrics recorded once the next handlers have
+	// run, e.g. the request size or a queue depth sent in a header
+	// Optional. Default: nil
+	CustomMetricsFromRequest func(c *fiber.Ctx) []CustomMetric
+	// FallbackStatusCode is the status code reported when a next handler panics and
+	// RecoverPanics is false, as the response has no status code yet. A response without
+	// a status code set by the handlers is reported as 200, like fasthttp sends it
+	// Optional. Default: 500
+	FallbackStatusCode int
+	// AppInfo describes the application, its version is recorded as app.version on every
+	// transaction
+	// Optional. Default: AppInfo{}
+	AppInfo AppInfo
+	// AppVersionFromEnv is the environment variable the application version is read from in
+	// New, e.g. the image tag injected by the deployment pipeline. AppInfo.Version takes
+	// precedence when both are set
+	// Optional. Default: ""
+	AppVersionFromEnv string
+	// NRTransactionCategory is the category of the transactions, CategoryWeb or
+	// CategoryBackground. Background transactions are reported without web request, e.g. for
+	// jobs triggered over HTTP
+	// Optional. Default: CategoryWeb
+	NRTransactionCategory string
+	// CategoryExtractor returns the category of the request transaction, overriding
+	// NRTransactionCategory unless it returns ""
+	// Optional. Default: nil
+	CategoryExtractor func(c *fiber.Ctx) string
+	// RecordFiberVersion records framework.name "fiber" and framework.version, the Fiber
+	// version read in New, on every transaction
+	// Optional. Default: false
+	RecordFiberVersion bool
+	// SlowRequestThreshold flags requests taking longer than this duration with the
+	// request.slow attribute. Zero disables the threshold
+	// Optional. Default: 0
+	SlowRequestThreshold time.Duration
+	// SlowHandlerCallback is called synchronously once the next handlers of a request
+	// exceeding SlowRequestThreshold have run, e.g. to dump goroutines or add attributes.
+	// Panics are recovered and logged
+	// Optional. Default: nil
+	SlowHandlerCallback func(c *fiber.Ctx, elapsed time.Duration)
+	// StartupTimeout waits up to this duration in New for the New Relic application to
+	// connect, and fails if it does not, e.g. to catch an invalid license in CI. New panics,
+	// NewE returns the error. Zero does not wait
+	// Optional. Default: 0
+	StartupTimeout time.Duration
+	// RecordResponseStatusCode records the response status code on the transaction. When
+	// false, the status code attribute and the status code based error reporting of New
+	// Relic are omitted, e.g. when 404s reveal the endpoint structure
+	// Optional. Default: true
+	RecordResponseStatusCode *bool
+	// MaxSegmentsPerTransaction caps the number of segments started by the segment helpers
+	// per request. Segments above the limit are no-ops and the transaction gets the
+	// nrMaxSegmentsExceeded attribute. Zero is unlimited
+	// Optional. Default: 0
+	MaxSegmentsPerTransaction int
+	// RecordRouteGroup records the leading path segment of the matched route as
+	// fiber.routeGroup, e.g. "/v1" for "/v1/users/:id". Routes with a single path
+	// segment are recorded as "/"
+	// Optional. Default: false
+	RecordRouteGroup bool
+	// TransactionAttributes is called once the next handlers have run. Every returned
+	// attribute is recorded on the transaction, so the attribute logic lives in one place
+	// instead of AddTransactionAttribute calls across the handlers
+	// Optional. Default: nil
+	TransactionAttributes func(c *fiber.Ctx) map[string]interface{}
+	// SanitizeAttributes is applied to the value of every attribute recorded by this
+	// package, e.g. to mask personal data. Returning nil drops the attribute
+	// Optional. Default: nil
+	SanitizeAttributes func(key string, value interface{}) interface{}
+	// Namespace identifies the middleware when several are mounted in one Fiber app, e.g.
+	// for a primary and a secondary New Relic account. FromContext with the namespace
+	// returns the transaction of that middleware
+	// Optional. Default: "default"
+	Namespace string
+	// TagAllWithRequestID records the ID set by Fiber's requestid middleware as request.id
+	// and sends it in the X-Request-ID header of the outgoing requests made with
+	// StartExternalSegment or WrapFastHTTPClient, so the transactions of the downstream
+	// services using the requestid middleware record the same ID. The requestid
+	// middleware has to run first
+	// Optional. Default: false
+	TagAllWithRequestID bool
+	// RecordScheme records the scheme of the request, "http" or "https", as request.scheme
+	// Optional. Default: false
+	RecordScheme bool
+	// RecordMethod records the HTTP method of the request as request.method, e.g. to facet
+	// on it in NRQL
+	// Optional. Default: false
+	RecordMethod bool
+	// RecordPort records the server port of the request host as server.port. Hosts without
+	// a port record the default port of the scheme, 80 or 443
+	// Optional. Default: false
+	RecordPort bool
+	// MaxErrorsPerRequest caps the number of errors noticed per request by the middleware
+	// and NoticeError. Errors above the limit are dropped and the transaction gets the
+	// nrMaxErrorsExceeded attribute. Zero is unlimited
+	// Optional. Default: 0
+	MaxErrorsPerRequest int
+	// RecordXForwardedFor records the client IP of the X-Forwarded-For header as
+	// request.xForwardedFor. The client IP is the rightmost address which is not one of
+	// the TrustedProxies
+	// Optional. Default: false
+	RecordXForwardedFor bool
+	// TrustedProxies are the IP addresses or CIDR ranges of the proxies skipped when
+	// selecting the client IP for RecordXForwardedFor, e.g. "10.0.0.0/8"
+	// Optional. Default: nil
+	TrustedProxies []string
+	// RecordAcceptHeader records the Accept header of the request as request.accept,
+	// truncated to 256 bytes
+	// Optional. Default: false
+	RecordAcceptHeader bool
+	// RewriteErrorMessages replaces the message of every error noticed by the middleware
+	// and NoticeError with the one returned by ErrorMessageRewriter
+	// Optional. Default: false
+	RewriteErrorMessages bool
+	// ErrorMessageRewriter returns the message reported for an error when
+	// RewriteErrorMessages is enabled, e.g. TruncatingRewriter. The class and the stack
+	// trace of the error are kept. Nil keeps err.Error()
+	// Optional. Default: nil
+	ErrorMessageRewriter func(err error) string
+	// RecordContentNegotiation records the Accept header of the request and the
+	// Content-Type of the response as negotiation.accepted and negotiation.contentType,
+	// and whether the response type was accepted as negotiation.match
+	// Optional. Default: false
+	RecordContentNegotiation bool
+	// MetricNameFormatter transforms the name of every custom metric recorded by this
+	// package, after MetricsPrefix was applied, e.g. PrefixMetricFormatter. New Relic
+	// still prepends "Custom/"
+	// Optional. Default: nil
+	MetricNameFormatter func(name string) string
+	// AutoInstrumentTemplates passes the transaction to the views engine decorated by
+	// NRViewsEngine, which creates a "render/<template>" segment around every c.Render
+	// Optional. Default: false
+	AutoInstrumentTemplates bool
+	// RecordCookieNames records the comma-separated names of the request cookies as
+	// request.cookieNames. Cookie values are never recorded
+	// Optional. Default: false
+	RecordCookieNames bool
+	// MultipleErrorHandlers replaces ErrorStatusCodeHandler with a chain trying each
+	// handler in order. The first non-zero status code wins, and
+	// DefaultErrorStatusCodeHandler is used when all of them return zero
+	// Optional. Default: nil
+	MultipleErrorHandlers []func(c *fiber.Ctx, err error) int
+	// RecordQueryParamCount records the number of query parameters of the request as
+	// request.queryParamCount. The parameter values are not recorded
+	// Optional. Default: false
+	RecordQueryParamCount bool
+	// RecordPathDepth records the number of non-empty segments of the request path as
+	// request.pathDepth, e.g. 3 for "/a/b/c"
+	// Optional. Default: false
+	RecordPathDepth bool
+	// RecordServerLoad records the number of CPUs, GOMAXPROCS and the number of goroutines
+	// as server.numCPU, server.maxProcs and server.numGoroutines
+	// Optional. Default: false
+	RecordServerLoad bool
+	// ServerLoadSampleInterval is the minimum time between two server load samples.
+	// Zero samples on every request
+	// Optional. Default: 0
+	ServerLoadSampleInterval time.Duration
+	// RecordHTTP2Push records the comma-separated URLs of the response Link headers with
+	// rel=preload and without nopush, which an HTTP/2 server or proxy pushes, as
+	// response.http2Push
+	// Optional. Default: false
+	RecordHTTP2Push bool
+	// LogTransactionErrors also logs every error noticed by the middleware and NoticeError,
+	// e.g. as a local audit trail when New Relic is disabled
+	// Optional. Default: false
+	LogTransactionErrors bool
+	// LogOutput is where LogTransactionErrors and AutoLinkLogsOnError write to. Nil uses
+	// the Fiber logger, or stderr for AutoLinkLogsOnError
+	// Optional. Default: nil
+	LogOutput io.Writer
+	// RecordHandlerName records the package-qualified function name of the last handler
+	// of the matched route as fiber.handlerName, e.g. "handlers.GetUser"
+	// Optional. Default: false
+	RecordHandlerName bool
+	// RecordRouteConstraints records the parameter constraints of the matched route as
+	// fiber.routeConstraints, e.g. "id:int,name:minLen(3)" for "/users/:id<int>/:name<minLen(3)>"
+	// Optional. Default: false
+	RecordRouteConstraints bool
+	// RecordFormData records the names of the fields of multipart form requests as
+	// request.formFields, and the names of the file fields as request.fileFields. Field
+	// values are never recorded. Streamed bodies and bodies larger than MaxBodySegmentSize
+	// are not parsed, so the names are not recorded
+	// Optional. Default: false
+	RecordFormData bool
+	// MaxFormDataFields is the maximum number of field names recorded by RecordFormData,
+	// for each of request.formFields and request.fileFields
+	// Optional. Default: 100
+	MaxFormDataFields int
+	// RecordReferer records the Referer header of the request as request.referer,
+	// without its query and fragment and truncated to 512 bytes
+	// Optional. Default: false
+	RecordReferer bool
+	// RefererIncludeQuery keeps the query of the referer recorded by RecordReferer
+	// Optional. Default: false
+	RefererIncludeQuery bool
+	// RecordOrigin records the Origin header of cross-origin requests as request.origin
+	// Optional. Default: false
+	RecordOrigin bool
+	// RecordForwardedProto records the X-Forwarded-Proto header of the request as
+	// request.forwardedProto, the scheme used by the client in front of a TLS
+	// terminating proxy
+	// Optional. Default: false
+	RecordForwardedProto bool
+	// RecordETagHeader records the ETag header of the response as response.etag, the
+	// If-None-Match header of the request as request.ifNoneMatch, and
+	// response.notModified on 304 responses
+	// Optional. Default: false
+	RecordETagHeader bool
+	// RecordRateLimitHeaders records the X-RateLimit-Remaining, X-RateLimit-Reset and
+	// Retry-After headers of the response as response.rateLimitRemaining,
+	// response.rateLimitReset and response.retryAfter, and response.rateLimited on 429
+	// responses
+	// Optional. Default: false
+	RecordRateLimitHeaders bool
+	// RecordCacheHeaders records the Cache-Control, X-Cache and Age headers of the
+	// response as response.cacheControl, response.xCache and response.age, and the
+	// max-age directive of Cache-Control as response.cacheMaxAge
+	// Optional. Default: false
+	RecordCacheHeaders bool
+	// RecordResponseTime records the elapsed time of the handler chain in milliseconds
+	// as response.durationMs
+	// Optional. Default: false
+	RecordResponseTime bool
+	// RecordStatusCodeClass records the class of the response status code, e.g. 400
+	// for 404, as response.statusClass
+	// Optional. Default: false
+	RecordStatusCodeClass bool
+	// RecordRoute records the path of the matched route, e.g. "/users/:id", as
+	// fiber.route
+	// Optional. Default: false
+	RecordRoute bool
+	// RecordMatchedHost records the host of the request, e.g. "api.example.com", as
+	// request.host
+	// Optional. Default: false
+	RecordMatchedHost bool
+	// GracefulPanicRecover reports panics raised by the next handlers to New Relic like
+	// RecoverPanics, but responds with 500 Internal Server Error and PanicResponseBody
+	// instead of raising the panic again
+	// Optional. Default: false
+	GracefulPanicRecover bool
+	// PanicResponseBody is the body of the response to panics recovered by
+	// GracefulPanicRecover
+	// Optional. Default: "Internal Server Error"
+	PanicResponseBody []byte
+	// RecordEnvironmentVars is a list of environment variables read once in New and added
+	// to CustomAttributes under their own name, e.g. "POD_NAME". Unlike TagsFromEnvironment,
+	// the names are not prefixed. Unset variables are skipped
+	// Optional. Default: nil
+	RecordEnvironmentVars []string
+	// NRTestMode creates a disabled New Relic application which never connects to New
+	// Relic, for unit and integration tests. License may be empty and StartupTimeout is
+	// ignored. Only applied when Application is nil
+	// Optional. Default: false
+	NRTestMode bool
+	// RecordCloudMetadata fetches the instance metadata of the cloud provider once in New,
+	// within 500ms, and adds it to CustomAttributes as cloud.provider, cloud.instanceType,
+	// cloud.region and cloud.zone. A warning is logged when the metadata is unavailable
+	// Optional. Default: false
+	RecordCloudMetadata bool
+	// CloudProvider is the cloud provider whose metadata is fetched by RecordCloudMetadata:
+	// CloudProviderAWS, CloudProviderGCP, CloudProviderAzure or CloudProviderAuto
+	// Optional. Default: "auto"
+	CloudProvider string
+	// MaxCustomAttributes is the maximum number of attributes added to a transaction by
+	// AddTransactionAttribute. Further attributes are dropped and the transaction is
+	// marked with the nrMaxAttrsExceeded attribute
+	// Optional. Default: 64
+	MaxCustomAttributes int
+	// RecordRequestHeaders records every request header as request.header.<name>, with
+	// the name lower cased, except the headers of HeaderDenyList
+	// Optional. Default: false
+	RecordRequestHeaders bool
+	// HeaderDenyList are the request headers not recorded by RecordRequestHeaders. The
+	// names are case insensitive
+	// Optional. Default: Authorization, Proxy-Authorization, Cookie, X-Api-Key,
+	// X-Auth-Token, X-Csrf-Token and X-Xsrf-Token
+	HeaderDenyList []string
+	// RequestTimeoutSegment records the time to first byte, approximated as the time until
+	// the next handlers returned, as a "ttfb" segment and as response.ttfbMs
+	// Optional. Default: false
+	RequestTimeoutSegment bool
+	// TraceContextPropagation is the format the distributed trace context is read from
+	// the request and written to outgoing requests in: PropagationNewRelic,
+	// PropagationW3C, PropagationB3, PropagationB3Multi or PropagationAuto. Empty keeps
+	// the agent behaviour, reading the headers only with UseImmutableContext
+	// Optional. Default: ""
+	TraceContextPropagation string
+	// RecordUserContext records the values of UserContextKeys in the user context after the
+	// next handlers returned, as ctx.<key>. Values other than strings, booleans, numbers and
+	// fmt.Stringer are skipped, with a warning logged once per key
+	// Optional. Default: false
+	RecordUserContext bool
+	// UserContextKeys are the user context keys recorded by RecordUserContext
+	// Optional. Default: nil
+	UserContextKeys []interface{}
+	// InjectTraceparentInResponse writes the W3C traceparent of the transaction to the
+	// TraceparentResponseHeader response header, like TraceParentHeader with a default name
+	// Optional. Default: false
+	InjectTraceparentInResponse bool
+	// TraceparentResponseHeader is the response header written by InjectTraceparentInResponse
+	// Optional. Default: "X-Traceparent"
+	TraceparentResponseHeader string
+	// LaggyStartupHandler serves the requests received before the New Relic application
+	// connected, instead of the next handlers, for at most LaggyStartupTimeout. Nil serves
+	// them normally
+	// Optional. Default: nil
+	LaggyStartupHandler fiber.Handler
+	// LaggyStartupTimeout is the duration after the middleware creation after which the
+	// requests are served normally, with a warning, when the New Relic application still
+	// did not connect, e.g. with an invalid license or a blocked network
+	// Optional. Default: 30 * time.Second
+	LaggyStartupTimeout time.Duration
+	// RecordRequestSize records the size of the request line, headers and body as
+	// request.totalBytes
+	// Optional. Default: false
+	RecordRequestSize bool
+	// MaxRequestSizeRead is the maximum number of body bytes counted by RecordRequestSize
+	// Optional. Default: 10485760
+	MaxRequestSizeRead int64
+	// RecordResponseSize records the size of the status line, headers and body of the
+	// response as response.totalBytes. Streamed bodies of unknown size, sent with chunked
+	// encoding, are only written after the transaction ended and are not counted
+	// Optional. Default: false
+	RecordResponseSize bool
+	// AllowlistHeaders restricts the headers recorded by RecordRequestHeaders,
+	// RecordAcceptHeader, RecordReferer, RecordOrigin, RecordForwardedProto,
+	// RecordXForwardedFor, RecordETagHeader, RecordRateLimitHeaders and RecordCacheHeaders
+	// to these headers. The names are case insensitive. Empty allows every header
+	// Optional. Default: nil
+	AllowlistHeaders []string
+	// DenylistHeaders are never recorded by the header recording features listed for
+	// AllowlistHeaders, and take precedence over AllowlistHeaders. The names are case
+	// insensitive
+	// Optional. Default: nil
+	DenylistHeaders []string
+	// UseTraceID names the transactions continuing a trace of the request after its trace
+	// ID, to stitch them with the upstream services. It takes precedence over UseRoutePath.
+	// Transactions starting a new trace keep their name
+	// Optional. Default: false
+	UseTraceID bool
+	// RecordPathParameters records the path parameters of the matched route as
+	// request.parameters.<name>
+	// Optional. Default: false
+	RecordPathParameters bool
+	// PathParameterDenyList lists the path parameters recorded as "<redacted>" by
+	// RecordPathParameters instead of their value, e.g. []string{"ssn", "cardNumber"}. The
+	// names are case insensitive
+	// Optional. Default: nil
+	PathParameterDenyList []string
+	// RecordQueryString records the raw query string of the request as
+	// request.queryString, truncated to MaxAttributeValueLength
+	// Optional. Default: false
+	RecordQueryString bool
+	// AutoLinkLogsOnError writes a JSON line with the error message and the New Relic
+	// linking metadata (trace.id, span.id, entity.name, entity.type, entity.guid and
+	// hostname) to LogOutput when a next handler returns an error, to find the trace
+	// from the logs
+	// Optional. Default: false
+	AutoLinkLogsOnError bool
+	// RecordFiberRequestID records the ID set by Fiber's requestid middleware as request.id,
+	// without adding it to the outgoing requests like TagAllWithRequestID. The
+	// requestid middleware has to run first
+	// Optional. Default: false
+	RecordFiberRequestID bool
+	// RecordPanicType records the type of the panic values recovered by RecoverPanics or
+	// GracefulPanicRecover as panic.type, e.g. "*runtime.TypeAssertionError", and the
+	// value as panic.value
+	// Optional. Default: false
+	RecordPanicType bool
+	// ConcurrentRequestsAttribute records the number of requests in flight in this
+	// middleware at the end of the transaction, including the request itself, as
+	// server.concurrentRequests
+	// Optional. Default: false
+	ConcurrentRequestsAttribute bool
+	// RequestBodyHashAttribute records the first 16 hex characters of the SHA-256 of the
+	// raw request body as request.bodyHash, to detect duplicate requests. Empty, streamed
+	// and larger than MaxBodyHashBytes bodies are not hashed
+	// Optional. Default: false
+	RequestBodyHashAttribute bool
+	// MaxBodyHashBytes is the size of the largest request body hashed by
+	// RequestBodyHashAttribute
+	// Optional. Default: 1048576
+	MaxBodyHashBytes int64
+	// RecordAllAttributes enables every boolean attribute recording option, e.g.
+	// RecordRequestHeaders, CaptureRequestBody or RecordQueryString, keeping the default
+	// size limits. For development only: never use it in production, as the recorded
+	// request data may contain personal information and increases the New Relic ingest.
+	// A warning is logged to LogOutput when set. RecordCloudMetadata, which queries the
+	// instance metadata endpoints, and the options changing the transactions or the
+	// responses are not enabled
+	// Optional. Default: false
+	RecordAllAttributes bool
 }
 
 var ConfigDefault = Config{
-	Application:            nil,
-	License:                "",
-	AppName:                "fiber-api",
-	Enabled:                false,
-	ErrorStatusCodeHandler: DefaultErrorStatusCodeHandler,
-	Next:                   nil,
+	Application:                    nil,
+	License:                        "",
+	AppName:                        "fiber-api",
+	Enabled:                        false,
+	ErrorStatusCodeHandler:         DefaultErrorStatusCodeHandler,
+	Next:                           nil,
+	UseRoutePath:                   false,
+	RouteGroupSeparator:            "",
+	MaxAttributeValueLength:        0,
+	RecordGoroutineCount:           false,
+	RecordMemStats:                 false,
+	MemStatsInterval:               0,
+	RecordRouteHandlerCount:        false,
+	Hooks:                          Hooks{},
+	DistributedTraceInboundHeaders: nil,
+	DistributedTraceOutboundHeader: "",
+	UseImmutableContext:            false,
+	MetricsPrefix:                  "",
+	ErrorSamplingRate:              nil,
+	FiberVersionAttribute:          false,
+	FiberVersionAsEvent:            false,
+	RecoverPanics:                  false,
+	PanicStackDepth:                32,
+	PanicNotifyOnce:                false,
+	PanicDeduplicationTTL:          0,
+	TransactionTimeout:             0,
+	SpanNameFormatter:              nil,
+	TransactionNameCacheSize:       0,
+	UserIDExtractor:                nil,
+	MaxBodySegmentSize:             64 * 1024,
+	ErrorTransformer:               nil,
+	CustomAttributes:               nil,
+	TagsFromEnvironment:            nil,
+	DrainTimeout:                   0,
+	SignalDrainEnabled:             nil,
+	SuppressEmptyTransactions:      false,
+	MinHandlersForTransaction:      1,
+	RequestIDHeader:                "",
+	HTTPClientWrapper:              false,
+	CaptureRequestBody:             false,
+	MaxCapturedBodyBytes:           4096,
+	NRErrorAttributes:              nil,
+	PostTransactionHook:            nil,
+	BodyParserSegmentName:          "request/body-parsing",
+	PropagateUserContext:           nil,
+	LimitConcurrentTransactions:    0,
+	NRApplicationName:              nil,
+	ApplicationCacheTTL:            0,
+	ApplicationCacheSize:           100,
+	RecordHTTPVersion:              false,
+	RecordTLSInfo:                  false,
+	RecordHostname:                 false,
+	ErrorAttributes:                nil,
+	SkipSuccessfulTransactions:     false,
+	TraceParentHeader:              "",
+	EventHarvest:                   EventHarvest{},
+	CustomMetricsFromRequest:       nil,
+	FallbackStatusCode:             fiber.StatusInternalServerError,
+	AppInfo:                        AppInfo{},
+	AppVersionFromEnv:              "",
+	NRTransactionCategory:          CategoryWeb,
+	CategoryExtractor:              nil,
+	RecordFiberVersion:             false,
+	SlowRequestThreshold:           0,
+	SlowHandlerCallback:            nil,
+	StartupTimeout:                 0,
+	RecordResponseStatusCode:       nil,
+	MaxSegmentsPerTransaction:      0,
+	RecordRouteGroup:               false,
+	TransactionAttributes:          nil,
+	SanitizeAttributes:             nil,
+	Namespace:                      "default",
+	TagAllWithRequestID:            false,
+	RecordScheme:                   false,
+	RecordMethod:                   false,
+	RecordPort:                     false,
+	MaxErrorsPerRequest:            0,
+	RecordXForwardedFor:            false,
+	TrustedProxies:                 nil,
+	RecordAcceptHeader:             false,
+	RewriteErrorMessages:           false,
+	ErrorMessageRewriter:           nil,
+	RecordContentNegotiation:       false,
+	MetricNameFormatter:            nil,
+	AutoInstrumentTemplates:        false,
+	RecordCookieNames:              false,
+	MultipleErrorHandlers:          nil,
+	RecordQueryParamCount:          false,
+	RecordPathDepth:                false,
+	RecordServerLoad:               false,
+	ServerLoadSampleInterval:       0,
+	RecordHTTP2Push:                false,
+	LogTransactionErrors:           false,
+	LogOutput:                      nil,
+	RecordHandlerName:              false,
+	RecordRouteConstraints:         false,
+	RecordFormData:                 false,
+	MaxFormDataFields:              100,
+	RecordReferer:                  false,
+	RefererIncludeQuery:            false,
+	RecordOrigin:                   false,
+	RecordForwardedProto:           false,
+	RecordETagHeader:               false,
+	RecordRateLimitHeaders:         false,
+	RecordCacheHeaders:             false,
+	RecordResponseTime:             false,
+	RecordStatusCodeClass:          false,
+	RecordRoute:                    false,
+	RecordMatchedHost:              false,
+	GracefulPanicRecover:           false,
+	PanicResponseBody:              []byte(utils.StatusMessage(fiber.StatusInternalServerError)),
+	RecordEnvironmentVars:          nil,
+	NRTestMode:                     false,
+	RecordCloudMetadata:            false,
+	CloudProvider:                  CloudProviderAuto,
+	MaxCustomAttributes:            64,
+	RecordRequestHeaders:           false,
+	HeaderDenyList:                 defaultHeaderDenyList,
+	RequestTimeoutSegment:          false,
+	TraceContextPropagation:        "",
+	RecordUserContext:              false,
+	UserContextKeys:                nil,
+	InjectTraceparentInResponse:    false,
+	TraceparentResponseHeader:      "X-Traceparent",
+	LaggyStartupHandler:            nil,
+	LaggyStartupTimeout:            30 * time.Second,
+	RecordRequestSize:              false,
+	MaxRequestSizeRead:             10 << 20,
+	RecordResponseSize:             false,
+	AllowlistHeaders:               nil,
+	DenylistHeaders:                nil,
+	UseTraceID:                     false,
+	RecordPathParameters:           false,
+	PathParameterDenyList:          nil,
+	RecordQueryString:              false,
+	AutoLinkLogsOnError:            false,
+	RecordFiberRequestID:           false,
+	RecordPanicType:                false,
+	ConcurrentRequestsAttribute:    false,
+	RequestBodyHashAttribute:       false,
+	MaxBodyHashBytes:               1 << 20,
+	RecordAllAttributes:            false,
 }
 
+// New creates the New Relic middleware. It panics when the New Relic
+// application can not be created or, with StartupTimeout, connected.
 func New(cfg Config) fiber.Handler {
-	var app *newrelic.Application
-	var err error
+	handler, err := NewE(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return handler
+}
+
+// WrapFiberApp registers the New Relic middleware created by New as a global
+// middleware of app and returns app for chaining. Call it before registering
+// any other middleware or route, so every request is instrumented.
+func WrapFiberApp(app *fiber.App, cfg Config) *fiber.App {
+	app.Use(New(cfg))
+
+	return app
+}
+
+// NewE creates the New Relic middleware like New, but returns an error instead
+// of panicking.
+func NewE(cfg Config) (fiber.Handler, error) {
+	if cfg.RecordAllAttributes {
+		enableAllAttributes(&cfg)
+	}
+
+	if len(cfg.MultipleErrorHandlers) > 0 {
+		cfg.ErrorStatusCodeHandler = chainErrorStatusCodeHandlers(cfg.MultipleErrorHandlers)
+	}
 
 	if cfg.ErrorStatusCodeHandler == nil {
 		cfg.ErrorStatusCodeHandler = ConfigDefault.ErrorStatusCodeHandler
 	}
 
-	if cfg.Application != nil {
-		app = cfg.Application
-	} else {
-		if cfg.AppName == "" {
-			cfg.AppName = ConfigDefault.AppName
-		}
+	if cfg.PanicStackDepth <= 0 {
+		cfg.PanicStackDepth = ConfigDefault.PanicStackDepth
+	}
 
-		if cfg.License == "" {
-			panic(fmt.Errorf("unable to create New Relic Application -> License can not be empty"))
+	if cfg.MaxBodySegmentSize == 0 {
+		cfg.MaxBodySegmentSize = ConfigDefault.MaxBodySegmentSize
+	}
+
+	if cfg.BodyParserSegmentName == "" {
+		cfg.BodyParserSegmentName = ConfigDefault.BodyParserSegmentName
+	}
+
+	if cfg.Namespace == "" {
+		cfg.Namespace = ConfigDefault.Namespace
+	}
+
+	if cfg.LaggyStartupTimeout <= 0 {
+		cfg.LaggyStartupTimeout = ConfigDefault.LaggyStartupTimeout
+	}
+
+	if cfg.ApplicationCacheSize <= 0 {
+		cfg.ApplicationCacheSize = ConfigDefault.ApplicationCacheSize
+	}
+
+	if cfg.FallbackStatusCode == 0 {
+		cfg.FallbackStatusCode = ConfigDefault.FallbackStatusCode
+	}
+
+	if cfg.MaxCapturedBodyBytes <= 0 {
+		cfg.MaxCapturedBodyBytes = ConfigDefault.MaxCapturedBodyBytes
+	}
+
+	if cfg.MaxFormDataFields <= 0 {
+		cfg.MaxFormDataFields = ConfigDefault.MaxFormDataFields
+	}
+
+	if cfg.MaxCustomAttributes <= 0 {
+		cfg.MaxCustomAttributes = ConfigDefault.MaxCustomAttributes
+	}
+
+	if cfg.MaxRequestSizeRead <= 0 {
+		cfg.MaxRequestSizeRead = ConfigDefault.MaxRequestSizeRead
+	}
+
+	if cfg.MaxBodyHashBytes <= 0 {
+		cfg.MaxBodyHashBytes = ConfigDefault.MaxBodyHashBytes
+	}
+
+	if cfg.TraceparentResponseHeader == "" {
+		cfg.TraceparentResponseHeader = ConfigDefault.TraceparentResponseHeader
+	}
+
+	if cfg.HeaderDenyList == nil {
+		cfg.HeaderDenyList = ConfigDefault.HeaderDenyList
+	}
+
+	if cfg.PanicResponseBody == nil {
+		cfg.PanicResponseBody = ConfigDefault.PanicResponseBody
+	}
+
+	if cfg.MinHandlersForTransaction <= 0 {
+		cfg.MinHandlersForTransaction = ConfigDefault.MinHandlersForTransaction
+	}
+
+	cfg.CustomAttributes = withEnvironmentTags(cfg.CustomAttributes, cfg.TagsFromEnvironment, "env.")
+	cfg.CustomAttributes = withEnvironmentTags(cfg.CustomAttributes, cfg.RecordEnvironmentVars, "")
+
+	if cfg.RecordHostname {
+		cfg.CustomAttributes = withHostname(cfg.CustomAttributes)
+	}
+
+	if cfg.RecordFiberVersion {
+		cfg.CustomAttributes = withAttribute(cfg.CustomAttributes, "framework.name", "fiber")
+		cfg.CustomAttributes = withAttribute(cfg.CustomAttributes, "framework.version", fiber.Version)
+	}
+
+	cfg.CustomAttributes = withAppVersion(cfg.CustomAttributes, cfg.AppInfo, cfg.AppVersionFromEnv)
+
+	if cfg.RecordCloudMetadata {
+		if err := validateCloudProvider(cfg.CloudProvider); err != nil {
+			return nil, err
 		}
+		cfg.CustomAttributes = withCloudMetadata(cfg.CustomAttributes, cfg.CloudProvider)
+	}
 
-		app, err = newrelic.NewApplication(
-			newrelic.ConfigAppName(cfg.AppName),
-			newrelic.ConfigLicense(cfg.License),
-			newrelic.ConfigEnabled(cfg.Enabled),
-		)
+	deniedHeaders := lowerSet(cfg.HeaderDenyList)
+	headers := newHeaderFilter(cfg.AllowlistHeaders, cfg.DenylistHeaders)
+	deniedPathParameters := lowerSet(cfg.PathParameterDenyList)
+
+	if err := validatePropagation(cfg.TraceContextPropagation); err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// The applications of NRApplicationName are created from License, not from Application.
+	if cfg.NRApplicationName != nil && cfg.License == "" && !cfg.NRTestMode {
+		return nil, fmt.Errorf("unable to create New Relic Application -> NRApplicationName requires License")
+	}
 
-		if err != nil {
-			panic(fmt.Errorf("unable to create New Relic Application -> %w", err))
+	created := cfg.Application == nil
+	app, err := createApplication(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.StartupTimeout > 0 && !(cfg.NRTestMode && created) {
+		if err := app.WaitForConnection(cfg.StartupTimeout); err != nil {
+			if created {
+				// Stops the connect loop of the application, which is not used.
+				app.Shutdown(0)
+			}
+			return nil, fmt.Errorf("unable to connect New Relic Application -> %w", err)
 		}
 	}
 
+	if drainEnabled(&cfg) {
+		drainer.register(app, cfg.DrainTimeout)
+	}
+
+	var (
+		memStats         = newMemStatsSampler(cfg.MemStatsInterval)
+		serverLoad       = newServerLoadSampler(cfg.ServerLoadSampleInterval)
+		fiberVersionOnce sync.Once
+		names            *nameCache
+		panics           *panicDeduplicator
+		slots            chan struct{}
+		tenants          *applicationCache
+		recordStatusCode = cfg.RecordResponseStatusCode == nil || *cfg.RecordResponseStatusCode
+		stateKey         = namespaceStateKey(cfg.Namespace)
+		// connected is set once the application connected, or did not
+		// connect within LaggyStartupTimeout, so that LaggyStartupHandler
+		// stops checking the connection.
+		connected int32
+		startup   = time.Now()
+		// inFlight counts the requests in flight for
+		// ConcurrentRequestsAttribute.
+		inFlight int64
+		// warnedUserContextKeys are the user context keys whose unsupported
+		// value was logged by RecordUserContext.
+		warnedUserContextKeys sync.Map
+	)
+
+	if cfg.NRApplicationName != nil {
+		tenants = newApplicationCache(cfg)
+	}
+
+	if cfg.LimitConcurrentTransactions > 0 {
+		slots = make(chan struct{}, cfg.LimitConcurrentTransactions)
+	}
+
+	if cfg.TransactionNameCacheSize > 0 {
+		names = newNameCache(cfg.TransactionNameCacheSize)
+	}
+
+	if cfg.PanicNotifyOnce {
+		panics = newPanicDeduplicator(cfg.PanicDeduplicationTTL)
+	}
+
 	return func(c *fiber.Ctx) error {
 		if cfg.Next != nil && cfg.Next(c) {
 			return c.Next()
 		}
 
-		txn := app.StartTransaction(createTransactionName(c))
-		defer txn.End()
+		if cfg.LaggyStartupHandler != nil && atomic.LoadInt32(&connected) == 0 {
+			switch {
+			case app.WaitForConnection(0) == nil:
+				atomic.StoreInt32(&connected, 1)
+			case time.Since(startup) < cfg.LaggyStartupTimeout:
+				return cfg.LaggyStartupHandler(c)
+			case atomic.CompareAndSwapInt32(&connected, 0, 1):
+				log.Warnf("fibernewrelic: the New Relic application did not connect within %s, serving the requests normally", cfg.LaggyStartupTimeout)
+			}
+		}
+
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			default:
+				recordCustomMetric(app, &cfg, skippedMetricName, 1)
+				return c.Next()
+			}
+		}
 
 		var (
-			host   = utils.CopyString(c.Hostname())
-			method = utils.CopyString(c.Method())
+			start      = time.Now()
+			statusCode int
 		)
 
-		scheme := c.Request().URI().Scheme()
+		txnApp := app
+		if tenants != nil {
+			var release func()
+			txnApp, release = tenants.get(c, app)
+			// Registered first, to run once the transaction ended.
+			defer release()
+		}
+
+		txn := txnApp.StartTransaction(createTransactionName(c))
+		state := &requestState{cfg: &cfg, txn: txn}
+		if cfg.ConcurrentRequestsAttribute {
+			atomic.AddInt64(&inFlight, 1)
+		}
+		defer func() {
+			// The status code is only unset when a next handler panicked.
+			if statusCode < 100 {
+				statusCode = cfg.FallbackStatusCode
+				if recordStatusCode {
+					txn.SetWebResponse(nil).WriteHeader(statusCode)
+				}
+			}
+			state.statusCode = statusCode
+
+			if cfg.ConcurrentRequestsAttribute {
+				// The request itself is still counted.
+				addAttribute(txn, &cfg, "server.concurrentRequests", atomic.AddInt64(&inFlight, -1)+1)
+			}
+
+			txn.End()
+
+			if cfg.PostTransactionHook != nil {
+				runHook("PostTransaction", func() {
+					cfg.PostTransactionHook(txn, c)
+				})
+			}
+
+			if cfg.Hooks.AfterTransaction != nil {
+				runHook("AfterTransaction", func() {
+					cfg.Hooks.AfterTransaction(c, txn, time.Since(start), statusCode)
+				})
+			}
+		}()
+
+		if cfg.Hooks.BeforeTransaction != nil {
+			runHook("BeforeTransaction", func() {
+				cfg.Hooks.BeforeTransaction(c, txn)
+			})
+		}
+
+		// generatedTraceID is the trace ID of the transaction before any inbound
+		// trace context is accepted. It only changes when the agent accepts a
+		// valid one.
+		generatedTraceID := txn.GetTraceMetadata().TraceID
+
+		req := newRequestInfo(c, cfg.UseImmutableContext)
+		if cfg.TraceContextPropagation != "" && req.header != nil {
+			stripTraceContextHeaders(req.header)
+		}
+		if transactionCategory(c, &cfg) != CategoryBackground {
+			txn.SetWebRequest(req.webRequest())
+		}
+
+		if cfg.TraceContextPropagation != "" {
+			acceptPropagatedHeaders(c, txn, cfg.TraceContextPropagation, req.transport())
+		}
+
+		if len(cfg.DistributedTraceInboundHeaders) > 0 {
+			acceptInboundHeaders(c, txn, cfg.DistributedTraceInboundHeaders, req.transport())
+		}
+
+		if cfg.RequestIDHeader != "" {
+			recordCorrelationID(c, txn, &cfg, cfg.RequestIDHeader, req.transport())
+		}
+
+		if cfg.TagAllWithRequestID {
+			tagWithRequestID(c, txn, &cfg)
+		}
+
+		if cfg.RecordFiberRequestID {
+			if id := RequestID(c); id != "" {
+				addAttribute(txn, &cfg, "request.id", id)
+			}
+		}
+
+		if cfg.TraceParentHeader != "" {
+			writeTraceparentHeader(c, txn, cfg.TraceParentHeader)
+		}
+
+		if cfg.InjectTraceparentInResponse {
+			writeTraceparentHeader(c, txn, cfg.TraceparentResponseHeader)
+		}
+
+		if cfg.DistributedTraceOutboundHeader != "" {
+			writeOutboundHeader(c, txn, cfg.DistributedTraceOutboundHeader)
+		}
+
+		userCtx := c.UserContext()
+		if cfg.PropagateUserContext != nil && !*cfg.PropagateUserContext {
+			userCtx = context.Background()
+		}
+		c.SetUserContext(newrelic.NewContext(userCtx, txn))
+		c.Locals(requestStateKey, state)
+		c.Locals(stateKey, state)
+
+		if cfg.AutoInstrumentTemplates {
+			_ = c.Bind(fiber.Map{viewsStateKey: state})
+		}
+
+		var ttfb *newrelic.Segment
+		if cfg.RequestTimeoutSegment {
+			ttfb = state.segmentTransaction().StartSegment("ttfb")
+		}
+
+		for key, value := range cfg.CustomAttributes {
+			addAttribute(txn, &cfg, key, value)
+		}
+
+		if cfg.RecordHTTPVersion {
+			// c.Protocol() returns the scheme, the version is only known to fasthttp.
+			addAttribute(txn, &cfg, "request.protocol", string(c.Request().Header.Protocol()))
+		}
+
+		if cfg.RecordMethod {
+			addAttribute(txn, &cfg, "request.method", c.Method())
+		}
+
+		if cfg.RecordQueryParamCount {
+			addAttribute(txn, &cfg, "request.queryParamCount", len(c.Queries()))
+		}
+
+		if cfg.RecordQueryString {
+			if qs := c.Request().URI().QueryString(); len(qs) > 0 {
+				addAttribute(txn, &cfg, "request.queryString", string(qs))
+			}
+		}
+
+		if cfg.RecordPathDepth {
+			addAttribute(txn, &cfg, "request.pathDepth", pathDepth(req.path))
+		}
+
+		if cfg.RecordCookieNames {
+			if names := cookieNames(c); names != "" {
+				addAttribute(txn, &cfg, "request.cookieNames", names)
+			}
+		}
+
+		if cfg.RecordRequestHeaders {
+			recordRequestHeaders(c, txn, &cfg, deniedHeaders, headers)
+		}
+
+		if cfg.RecordAcceptHeader {
+			if accept := headers.request(c, fiber.HeaderAccept); accept != "" {
+				addAttribute(txn, &cfg, "request.accept", truncateString(accept, maxAcceptHeaderLength))
+			}
+		}
+
+		if cfg.RecordReferer {
+			if referer := stripReferer(headers.request(c, fiber.HeaderReferer), cfg.RefererIncludeQuery); referer != "" {
+				addAttribute(txn, &cfg, "request.referer", truncateString(referer, maxRefererLength))
+			}
+		}
+
+		if cfg.RecordOrigin {
+			if origin := headers.request(c, fiber.HeaderOrigin); origin != "" {
+				addAttribute(txn, &cfg, "request.origin", origin)
+			}
+		}
+
+		if cfg.RecordForwardedProto {
+			if proto := headers.request(c, fiber.HeaderXForwardedProto); proto != "" {
+				addAttribute(txn, &cfg, "request.forwardedProto", proto)
+			}
+		}
+
+		if cfg.RecordXForwardedFor {
+			if ip := forwardedClientIP(headers.request(c, fiber.HeaderXForwardedFor), trustedProxies); ip != "" {
+				addAttribute(txn, &cfg, "request.xForwardedFor", ip)
+			}
+		}
+
+		if cfg.RecordMatchedHost {
+			addAttribute(txn, &cfg, "request.host", req.host)
+		}
+
+		if cfg.RecordPort {
+			addAttribute(txn, &cfg, "server.port", req.port())
+		}
+
+		if cfg.RecordScheme {
+			addAttribute(txn, &cfg, "request.scheme", string(c.Request().URI().Scheme()))
+		}
+
+		if cfg.RecordTLSInfo {
+			recordTLSInfo(c, txn, &cfg)
+		}
+
+		if cfg.RecordGoroutineCount {
+			recordGoroutineCount(txn, &cfg)
+		}
+
+		if cfg.RecordMemStats {
+			recordMemStats(txn, &cfg, memStats)
+		}
+
+		if cfg.RecordServerLoad {
+			recordServerLoad(txn, &cfg, serverLoad)
+		}
+
+		if cfg.FiberVersionAttribute {
+			recordFiberVersion(txn, &cfg, &fiberVersionOnce)
+		}
+
+		if cfg.RecoverPanics || cfg.GracefulPanicRecover {
+			defer func() {
+				if r := recover(); r != nil {
+					statusCode = fiber.StatusInternalServerError
+					if cfg.RecordPanicType {
+						recordPanicType(txn, &cfg, r)
+					}
+					if panicErr := newPanicError(r, cfg.PanicStackDepth); panics == nil || panics.shouldNotify(panicErr.Stack) {
+						state.noticeError(withErrorAttributes(panicErr, cfg.NRErrorAttributes))
+					}
+					if recordStatusCode {
+						txn.SetWebResponse(nil).WriteHeader(statusCode)
+					}
+
+					if !cfg.GracefulPanicRecover {
+						panic(r)
+					}
+
+					// The handler may have panicked halfway through writing its response.
+					c.Response().ResetBody()
+					c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+					c.Status(statusCode).Response().SetBody(cfg.PanicResponseBody)
+				}
+			}()
+		}
+
+		ownRoute := c.Route()
 
-		txn.SetWebRequest(newrelic.WebRequest{
-			Host:      host,
-			Method:    method,
-			Transport: transport(string(scheme)),
-			URL: &url.URL{
-				Host:     host,
-				Scheme:   string(c.Request().URI().Scheme()),
-				Path:     string(c.Request().URI().Path()),
-				RawQuery: string(c.Request().URI().QueryString()),
-			},
-		})
+		var handlerErr error
+		if cfg.TransactionTimeout > 0 {
+			handlerErr = nextWithTimeout(c, cfg.TransactionTimeout)
+		} else {
+			handlerErr = c.Next()
+		}
 
-		c.SetUserContext(newrelic.NewContext(c.UserContext(), txn))
+		if ttfb != nil {
+			ttfb.End()
+			addAttribute(txn, &cfg, "response.ttfbMs", time.Since(start).Milliseconds())
+		}
 
-		handlerErr := c.Next()
-		statusCode := c.Context().Response.StatusCode()
+		// fasthttp reports 200 when no status code was set.
+		statusCode = c.Context().Response.StatusCode()
 
 		if handlerErr != nil {
 			statusCode = cfg.ErrorStatusCodeHandler(c, handlerErr)
-			txn.NoticeError(handlerErr)
+
+			if cfg.ErrorAttributes != nil {
+				for key, value := range cfg.ErrorAttributes(c, handlerErr) {
+					addAttribute(txn, &cfg, key, value)
+				}
+			}
+
+			reportErr := handlerErr
+			if cfg.ErrorTransformer != nil {
+				reportErr = cfg.ErrorTransformer(reportErr)
+			}
+
+			if reportErr != nil && shouldReportError(cfg.ErrorSamplingRate) {
+				state.noticeError(withErrorAttributes(reportErr, cfg.NRErrorAttributes))
+			}
+
+			if cfg.AutoLinkLogsOnError {
+				logErrorLinkingMetadata(&cfg, txn, handlerErr)
+			}
 		}
 
-		txn.SetWebResponse(nil).WriteHeader(statusCode)
+		if cfg.RecordRequestSize {
+			addAttribute(txn, &cfg, "request.totalBytes", requestSize(c, cfg.MaxRequestSizeRead))
+		}
+
+		if cfg.RequestBodyHashAttribute {
+			if hash := bodyHash(c, cfg.MaxBodyHashBytes); hash != "" {
+				addAttribute(txn, &cfg, "request.bodyHash", hash)
+			}
+		}
+
+		if cfg.RecordFormData {
+			recordFormFields(c, txn, &cfg, cfg.MaxFormDataFields)
+		}
+
+		if cfg.CaptureRequestBody && statusCode >= fiber.StatusInternalServerError && !c.Request().IsBodyStream() {
+			// The raw body, as c.Body decodes compressed bodies into memory.
+			addAttribute(txn, &cfg, "request.body", truncateString(string(c.Request().Body()), cfg.MaxCapturedBodyBytes))
+		}
+
+		if cfg.RecordResponseTime {
+			addAttribute(txn, &cfg, "response.durationMs", time.Since(start).Milliseconds())
+		}
+
+		if elapsed := time.Since(start); cfg.SlowRequestThreshold > 0 && elapsed > cfg.SlowRequestThreshold {
+			addAttribute(txn, &cfg, "request.slow", true)
+
+			if cfg.SlowHandlerCallback != nil {
+				runHook("SlowHandler", func() {
+					cfg.SlowHandlerCallback(c, elapsed)
+				})
+			}
+		}
+
+		if cfg.CustomMetricsFromRequest != nil {
+			for _, metric := range cfg.CustomMetricsFromRequest(c) {
+				recordCustomMetric(txnApp, &cfg, metric.Name, metric.Value)
+			}
+		}
+
+		if cfg.RecordHTTP2Push {
+			if urls := http2PushURLs(c.Response().Header.PeekAll(fiber.HeaderLink)); len(urls) > 0 {
+				addAttribute(txn, &cfg, "response.http2Push", strings.Join(urls, ","))
+			}
+		}
+
+		if cfg.RecordETagHeader {
+			if etag := headers.response(c, fiber.HeaderETag); etag != "" {
+				addAttribute(txn, &cfg, "response.etag", etag)
+			}
+			if ifNoneMatch := headers.request(c, fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+				addAttribute(txn, &cfg, "request.ifNoneMatch", ifNoneMatch)
+			}
+			if statusCode == fiber.StatusNotModified {
+				addAttribute(txn, &cfg, "response.notModified", true)
+			}
+		}
+
+		if cfg.RecordResponseSize {
+			addAttribute(txn, &cfg, "response.totalBytes", responseSize(c))
+		}
+
+		if cfg.RecordRateLimitHeaders {
+			recordRateLimitHeaders(c, txn, &cfg, headers, statusCode)
+		}
+
+		if cfg.RecordCacheHeaders {
+			recordCacheHeaders(c, txn, &cfg, headers)
+		}
+
+		if cfg.RecordContentNegotiation {
+			accept := c.Get(fiber.HeaderAccept)
+			contentType := string(c.Response().Header.ContentType())
+			addAttribute(txn, &cfg, "negotiation.accepted", truncateString(accept, maxAcceptHeaderLength))
+			addAttribute(txn, &cfg, "negotiation.contentType", contentType)
+			addAttribute(txn, &cfg, "negotiation.match", acceptsMediaType(accept, contentType))
+		}
+
+		if cfg.RecordUserContext {
+			recordUserContext(c.UserContext(), txn, &cfg, cfg.UserContextKeys, &warnedUserContextKeys)
+		}
+
+		if cfg.TransactionAttributes != nil {
+			for key, value := range cfg.TransactionAttributes(c) {
+				addAttribute(txn, &cfg, key, value)
+			}
+		}
+
+		if cfg.UserIDExtractor != nil {
+			if userID := cfg.UserIDExtractor(c); userID != "" {
+				txn.SetUserID(utils.CopyString(userID))
+			}
+		}
+
+		if cfg.RecordRouteHandlerCount {
+			addAttribute(txn, &cfg, "fiber.handlerCount", len(c.Route().Handlers))
+		}
+
+		if cfg.RecordRouteConstraints {
+			if constraints := routeConstraints(c.Route().Path); constraints != "" {
+				addAttribute(txn, &cfg, "fiber.routeConstraints", constraints)
+			}
+		}
+
+		if cfg.RecordRoute && c.Route() != ownRoute {
+			addAttribute(txn, &cfg, "fiber.route", c.Route().Path)
+		}
+
+		if cfg.RecordPathParameters && c.Route() != ownRoute {
+			recordPathParameters(c, txn, &cfg, deniedPathParameters)
+		}
+
+		if cfg.RecordRouteGroup {
+			addAttribute(txn, &cfg, "fiber.routeGroup", routeGroup(c.Route().Path))
+		}
+
+		if cfg.RecordHandlerName {
+			if handlers := c.Route().Handlers; c.Route() != ownRoute && len(handlers) > 0 {
+				addAttribute(txn, &cfg, "fiber.handlerName", shortHandlerName(handlers[len(handlers)-1]))
+			}
+		}
+
+		if cfg.RecordStatusCodeClass {
+			addAttribute(txn, &cfg, "response.statusClass", statusCode/100*100)
+		}
+
+		if (cfg.SuppressEmptyTransactions && routeHandlerCount(c, ownRoute) < cfg.MinHandlersForTransaction) ||
+			(cfg.SkipSuccessfulTransactions && statusCode >= 200 && statusCode < 300) {
+			txn.Ignore()
+			state.ignored = true
+		}
+
+		if cfg.UseRoutePath {
+			if c.Route() != ownRoute {
+				txn.SetName(routeTransactionName(c, cfg.RouteGroupSeparator, names))
+			} else {
+				// c.Route() is still the route of this middleware when no route
+				// matched, which would merge every 404 into its transaction.
+				txn.SetName(string(c.Request().Header.Method()) + " " + notFoundTransactionName)
+			}
+		}
+
+		if cfg.UseTraceID {
+			if traceID := txn.GetTraceMetadata().TraceID; traceID != "" && traceID != generatedTraceID {
+				txn.SetName(traceID)
+			}
+		}
+
+		if recordStatusCode {
+			txn.SetWebResponse(nil).WriteHeader(statusCode)
+		}
 
 		return handlerErr
+	}, nil
+}
+
+// transactionCategory returns the category of the request transaction.
+func transactionCategory(c *fiber.Ctx, cfg *Config) string {
+	if cfg.CategoryExtractor != nil {
+		if category := cfg.CategoryExtractor(c); category != "" {
+			return category
+		}
+	}
+
+	return cfg.NRTransactionCategory
+}
+
+// routeHandlerCount returns the number of handlers of the route matched after
+// own, the route of this middleware, or zero when no other route was reached.
+func routeHandlerCount(c *fiber.Ctx, own *fiber.Route) int {
+	route := c.Route()
+	if route == own {
+		return 0
+	}
+
+	return len(route.Handlers)
+}
+
+// routeConstraintPattern matches a route parameter with constraints, e.g.
+// ":id<int;min(1)>", capturing the parameter name and the constraints.
+var routeConstraintPattern = regexp.MustCompile(`:([\w-]+)<([^>]+)>`)
+
+// routeConstraints returns the "<param>:<constraint>" pairs of the parameter
+// constraints of a route path, separated by commas.
+func routeConstraints(path string) string {
+	matches := routeConstraintPattern.FindAllStringSubmatch(path, -1)
+
+	pairs := make([]string, 0, len(matches))
+	for _, match := range matches {
+		pairs = append(pairs, match[1]+":"+match[2])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// routeGroup returns the leading path segment of a route path with more than
+// one segment, or "/" for root-level routes.
+func routeGroup(path string) string {
+	trimmed := strings.TrimPrefix(path, "/")
+	i := strings.IndexByte(trimmed, '/')
+	if i <= 0 {
+		return "/"
+	}
+
+	return "/" + trimmed[:i]
+}
+
+// testModeLicense is the placeholder license of the application created with
+// Config.NRTestMode, which is never sent to New Relic.
+const testModeLicense = "0000000000000000000000000000000000000000"
+
+// createApplication returns the configured New Relic application, or creates
+// a new one from the config.
+// newApplication creates the applications of the middleware, replaced by tests.
+var newApplication = newrelic.NewApplication
+
+func createApplication(cfg *Config) (*newrelic.Application, error) {
+	if cfg.Application != nil {
+		return cfg.Application, nil
+	}
+
+	if cfg.AppName == "" {
+		cfg.AppName = ConfigDefault.AppName
+	}
+
+	if cfg.NRTestMode {
+		if cfg.License == "" {
+			cfg.License = testModeLicense
+		}
+		cfg.Enabled = false
+	}
+
+	if cfg.License == "" {
+		return nil, fmt.Errorf("unable to create New Relic Application -> License can not be empty")
+	}
+
+	if err := cfg.EventHarvest.validate(); err != nil {
+		return nil, fmt.Errorf("unable to create New Relic Application -> %w", err)
 	}
+
+	app, err := newApplication(
+		newrelic.ConfigAppName(cfg.AppName),
+		newrelic.ConfigLicense(cfg.License),
+		newrelic.ConfigEnabled(cfg.Enabled),
+		cfg.EventHarvest.configOption(),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create New Relic Application -> %w", err)
+	}
+
+	return app, nil
 }
 
 // FromContext returns the Transaction from the context if present, and nil
-// otherwise.
-func FromContext(c *fiber.Ctx) *newrelic.Transaction {
+// otherwise. With a namespace, it returns the Transaction of the middleware
+// with that Config.Namespace, instead of the one of the innermost middleware.
+func FromContext(c *fiber.Ctx, namespace ...string) *newrelic.Transaction {
+	if len(namespace) > 0 {
+		state, _ := c.Locals(namespaceStateKey(namespace[0])).(*requestState)
+		if state == nil {
+			return nil
+		}
+
+		return state.txn
+	}
+
 	return newrelic.FromContext(c.UserContext())
 }
 
+// FromUserContext returns the Transaction from a context derived from
+// c.UserContext() of an instrumented request, e.g. in a service layer which is
+// not given the fiber.Ctx, and nil otherwise. A nil ctx returns nil.
+func FromUserContext(ctx context.Context) *newrelic.Transaction {
+	if ctx == nil {
+		return nil
+	}
+
+	return newrelic.FromContext(ctx)
+}
+
+// nextWithTimeout calls the next handler with a user context which is
+// cancelled after timeout. Like Fiber's timeout middleware, the request is
+// considered timed out when the deadline passed by the time the handler returns.
+func nextWithTimeout(c *fiber.Ctx, timeout time.Duration) error {
+	parent := c.UserContext()
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	c.SetUserContext(ctx)
+	err := c.Next()
+	c.SetUserContext(parent)
+
+	if errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded {
+		return fiber.ErrRequestTimeout
+	}
+
+	return err
+}
+
+// notFoundTransactionName names the requests matching no route with
+// Config.UseRoutePath, to keep the raw paths of 404s out of the transaction
+// names.
+const notFoundTransactionName = "(not found)"
+
 func createTransactionName(c *fiber.Ctx) string {
 	return fmt.Sprintf("%s %s", c.Request().Header.Method(), c.Request().URI().Path())
 }
 
+func createRouteTransactionName(c *fiber.Ctx, separator string) string {
+	path := collapseSlashes(c.Route().Path)
+
+	if separator != "" {
+		if prefix, rest := splitRouteGroup(path); rest != "" {
+			path = prefix + separator + strings.TrimPrefix(rest, "/")
+		}
+	}
+
+	return fmt.Sprintf("%s %s", c.Request().Header.Method(), path)
+}
+
+// splitRouteGroup splits a route path into its group prefix (the leading path
+// segment) and the remaining sub-path. rest is empty for root-level routes.
+func splitRouteGroup(path string) (prefix, rest string) {
+	if i := strings.IndexByte(strings.TrimPrefix(path, "/"), '/'); i >= 0 {
+		return path[:i+1], path[i+1:]
+	}
+
+	return path, ""
+}
+
+func collapseSlashes(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+
+	return path
+}
+
 func transport(schema string) newrelic.TransportType {
 	if strings.HasPrefix(schema, "https") {
 		return newrelic.TransportHTTPS
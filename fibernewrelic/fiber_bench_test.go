@@ -0,0 +1,67 @@
+package fibernewrelic
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// BenchmarkMiddleware measures the overhead of the middleware against a plain
+// Fiber handler. The New Relic application is connected to the in-memory test
+// collector, so nothing is sent over the network.
+func BenchmarkMiddleware(b *testing.B) {
+	handler := func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	}
+
+	benchmarks := []struct {
+		name   string
+		config func(cfg *Config)
+	}{
+		{name: "baseline", config: nil},
+		{name: "default", config: func(cfg *Config) {}},
+		{name: "all attributes", config: func(cfg *Config) {
+			cfg.RecordAllAttributes = true
+			cfg.LogOutput = io.Discard
+			cfg.UseImmutableContext = true
+			cfg.UseRoutePath = true
+			cfg.RecoverPanics = true
+			cfg.RequestIDHeader = "X-Correlation-ID"
+			cfg.UserIDExtractor = JWTSubExtractor(fiber.HeaderAuthorization)
+			cfg.CustomAttributes = map[string]interface{}{"team": "payments"}
+		}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			app := fiber.New()
+			if bm.config != nil {
+				nrApp, _ := newTestApplication(b)
+				defer nrApp.Shutdown(0)
+
+				cfg := Config{Application: nrApp, Enabled: true}
+				bm.config(&cfg)
+				app.Use(New(cfg))
+			}
+			app.Get("/users/:id", handler)
+
+			h := app.Handler()
+			fctx := &fasthttp.RequestCtx{}
+			fctx.Request.Header.SetMethod(fiber.MethodGet)
+			fctx.Request.SetRequestURI("/users/1")
+			fctx.Request.Header.Set("X-Correlation-ID", "req-42")
+			fctx.Request.Header.SetContentType(fiber.MIMEApplicationJSON)
+			fctx.Request.SetBodyString(`{"name":"gopher"}`)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				h(fctx)
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package fibernewrelic
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gofiber/contrib/fibernewrelic/internal/collector"
 	"github.com/gofiber/fiber/v2"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/stretchr/testify/assert"
@@ -406,3 +411,928 @@ func TestFromContext(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
 }
+
+func TestUseRoutePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		route     string
+		separator string
+		url       string
+		expected  string
+	}{
+		{name: "without separator", prefix: "/v1", route: "/users/:id", url: "/v1/users/42", expected: "GET /v1/users/:id"},
+		{name: "with slash separator", prefix: "/v1", route: "/users/:id", separator: "/", url: "/v1/users/42", expected: "GET /v1/users/:id"},
+		{name: "with dot separator", prefix: "/v1", route: "/users/:id", separator: ".", url: "/v1/users/42", expected: "GET /v1.users/:id"},
+		{name: "group with trailing slash", prefix: "/v1/", route: "/users", separator: ".", url: "/v1/users", expected: "GET /v1.users"},
+		{name: "route with double leading slash", prefix: "/v1", route: "//users", separator: ".", url: "/v1//users", expected: "GET /v1.users"},
+		{name: "root level route", prefix: "/", route: "/users", separator: ".", url: "/users", expected: "GET /users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{
+				Application:         nrApp,
+				UseRoutePath:        true,
+				RouteGroupSeparator: tt.separator,
+			}))
+			app.Group(tt.prefix).Get(tt.route, func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.url, nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			txns := collector.transactionEvents(t, nrApp)
+			if assert.Len(t, txns, 1) {
+				assert.Equal(t, "WebTransaction/Go/"+tt.expected, txns[0].Intrinsics["name"])
+			}
+		})
+	}
+
+	t.Run("unmatched routes are named not found", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, UseRoutePath: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		for _, url := range []string{"/", "/missing", "/wp-admin.php"} {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+			assert.NoError(t, err)
+		}
+
+		var names []interface{}
+		for _, txn := range collector.transactionEvents(t, nrApp) {
+			names = append(names, txn.Intrinsics["name"])
+		}
+		assert.ElementsMatch(t, []interface{}{
+			"WebTransaction/Go/GET /",
+			"WebTransaction/Go/GET (not found)",
+			"WebTransaction/Go/GET (not found)",
+		}, names)
+	})
+
+	t.Run("separator is ignored without UseRoutePath", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RouteGroupSeparator: "."}))
+		app.Group("/v1").Get("/users/:id", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/v1/users/42", nil), -1)
+		assert.NoError(t, err)
+
+		txns := collector.transactionEvents(t, nrApp)
+		if assert.Len(t, txns, 1) {
+			assert.Equal(t, "WebTransaction/Go/GET /v1/users/42", txns[0].Intrinsics["name"])
+		}
+	})
+}
+
+func TestRecordRouteHandlerCount(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordRouteHandlerCount: enabled}))
+
+		middleware := func(ctx *fiber.Ctx) error { return ctx.Next() }
+		app.Get("/", middleware, middleware, func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		txns := collector.transactionEvents(t, nrApp)
+		if !assert.Len(t, txns, 1) {
+			continue
+		}
+
+		if enabled {
+			assert.Equal(t, float64(3), txns[0].UserAttributes["fiber.handlerCount"])
+		} else {
+			assert.NotContains(t, txns[0].UserAttributes, "fiber.handlerCount")
+		}
+	}
+}
+
+func TestRecordRouteGroup(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordRouteGroup: true}))
+
+	handler := func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) }
+	app.Group("/v1").Get("/users/:id", handler)
+	app.Get("/", handler)
+	app.Get("/health", handler)
+
+	// when
+	for _, url := range []string{"/v1/users/42", "/", "/health"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, "/v1", findTransaction(t, txns, "GET /v1/users/42").UserAttributes["fiber.routeGroup"])
+	assert.Equal(t, "/", findTransaction(t, txns, "GET /").UserAttributes["fiber.routeGroup"])
+	assert.Equal(t, "/", findTransaction(t, txns, "GET /health").UserAttributes["fiber.routeGroup"])
+}
+
+func TestRecordRoute(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordRoute: true}))
+	app.Group("/v1").Get("/users/:id", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, url := range []string{"/v1/users/42", "/missing"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, "/v1/users/:id", findTransaction(t, txns, "GET /v1/users/42").UserAttributes["fiber.route"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /missing").UserAttributes, "fiber.route")
+}
+
+func TestRecordRouteConstraints(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordRouteConstraints: true, UseRoutePath: true}))
+
+	handler := func(ctx *fiber.Ctx) error { return ctx.SendStatus(http.StatusOK) }
+	app.Get("/users/:id<int>/posts/:slug<minLen(3);maxLen(20)>", handler)
+	app.Get("/users/:id", handler)
+
+	// when
+	for _, url := range []string{"/users/42/posts/hello", "/users/jane"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	constrained := findTransaction(t, txns, "GET /users/:id<int>/posts/:slug<minLen(3);maxLen(20)>")
+	assert.Equal(t, "id:int,slug:minLen(3);maxLen(20)", constrained.UserAttributes["fiber.routeConstraints"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /users/:id").UserAttributes, "fiber.routeConstraints")
+}
+
+func TestRouteGroup(t *testing.T) {
+	for path, group := range map[string]string{
+		"":              "/",
+		"/":             "/",
+		"/health":       "/",
+		"/v1/users":     "/v1",
+		"/admin/users/": "/admin",
+		"//users":       "/",
+	} {
+		assert.Equal(t, group, routeGroup(path), path)
+	}
+}
+
+func getUserHandler(ctx *fiber.Ctx) error {
+	return ctx.SendStatus(http.StatusOK)
+}
+
+func TestRecordHandlerName(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordHandlerName: true}))
+	app.Get("/users/:id", func(ctx *fiber.Ctx) error { return ctx.Next() }, getUserHandler)
+
+	// when
+	for _, url := range []string{"/users/42", "/missing"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, "fibernewrelic.getUserHandler", findTransaction(t, txns, "GET /users/42").UserAttributes["fiber.handlerName"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /missing").UserAttributes, "fiber.handlerName")
+}
+
+func TestTransactionTimeout(t *testing.T) {
+	newApp := func(t *testing.T, handler fiber.Handler) (*fiber.App, *testCollector, *newrelic.Application) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, TransactionTimeout: 20 * time.Millisecond}))
+		app.Get("/", handler)
+		return app, collector, nrApp
+	}
+
+	t.Run("should respond with request timeout when the handler is too slow", func(t *testing.T) {
+		app, collector, nrApp := newApp(t, func(ctx *fiber.Ctx) error {
+			select {
+			case <-ctx.UserContext().Done():
+				return ctx.UserContext().Err()
+			case <-time.After(time.Second):
+				return ctx.SendStatus(http.StatusOK)
+			}
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+
+		events := collector.errorEvents(t, nrApp)
+		assert.Contains(t, errorClasses(events), "*fiber.Error")
+		for _, event := range events {
+			assert.Equal(t, float64(http.StatusRequestTimeout), event.AgentAttributes["http.statusCode"])
+		}
+	})
+
+	t.Run("should respond with request timeout when the handler ignores the context", func(t *testing.T) {
+		app, _, _ := newApp(t, func(ctx *fiber.Ctx) error {
+			time.Sleep(40 * time.Millisecond)
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	})
+
+	t.Run("should not report an error when the handler completes in time", func(t *testing.T) {
+		app, collector, nrApp := newApp(t, func(ctx *fiber.Ctx) error {
+			_, hasDeadline := ctx.UserContext().Deadline()
+			assert.True(t, hasDeadline)
+			assert.NotNil(t, FromContext(ctx))
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, collector.errorEvents(t, nrApp))
+	})
+}
+
+func authMiddleware(ctx *fiber.Ctx) error { return ctx.Next() }
+
+func TestHandlerName(t *testing.T) {
+	assert.Equal(t, "github.com/gofiber/contrib/fibernewrelic.authMiddleware", handlerName(authMiddleware))
+}
+
+func TestSuppressEmptyTransactions(t *testing.T) {
+	tests := []struct {
+		name        string
+		minHandlers int
+		path        string
+		reported    bool
+	}{
+		{name: "should report a single handler route by default", path: "/preflight", reported: true},
+		{name: "should ignore routes below the threshold", minHandlers: 2, path: "/preflight", reported: false},
+		{name: "should ignore routes short-circuited by a middleware above the threshold", minHandlers: 2, path: "/cached", reported: false},
+		{name: "should ignore requests not reaching another route", path: "/missing", reported: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, SuppressEmptyTransactions: true, MinHandlersForTransaction: tt.minHandlers}))
+			app.Use("/cached", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusNotModified)
+			})
+			app.Options("/preflight", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusNoContent)
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodOptions, tt.path, nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			txns := collector.transactionEvents(t, nrApp)
+			if tt.reported {
+				assert.Len(t, txns, 1)
+			} else {
+				assert.Empty(t, txns)
+			}
+		})
+	}
+}
+
+func TestPropagateUserContext(t *testing.T) {
+	type ctxKey struct{}
+	disabled := false
+
+	tests := []struct {
+		name      string
+		propagate *bool
+		expected  interface{}
+	}{
+		{name: "should keep user context values by default", propagate: nil, expected: "request-value"},
+		{name: "should drop user context values when disabled", propagate: &disabled, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrApp, _ := newTestApplication(t)
+			app := fiber.New()
+			app.Use(func(ctx *fiber.Ctx) error {
+				ctx.SetUserContext(context.WithValue(ctx.UserContext(), ctxKey{}, "request-value"))
+				return ctx.Next()
+			})
+			app.Use(New(Config{Application: nrApp, PropagateUserContext: tt.propagate}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				assert.Equal(t, tt.expected, ctx.UserContext().Value(ctxKey{}))
+				assert.NotNil(t, newrelic.FromContext(ctx.UserContext()))
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+}
+
+func TestLimitConcurrentTransactions(t *testing.T) {
+	// given
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, LimitConcurrentTransactions: 1}))
+	app.Get("/slow", func(ctx *fiber.Ctx) error {
+		close(started)
+		<-release
+		return ctx.SendString("slow")
+	})
+	app.Get("/fast", func(ctx *fiber.Ctx) error {
+		return ctx.SendString("fast")
+	})
+
+	slow := make(chan *http.Response)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil), -1)
+		assert.NoError(t, err)
+		slow <- resp
+	}()
+	<-started
+
+	// when
+	fast, err := app.Test(httptest.NewRequest(http.MethodGet, "/fast", nil), -1)
+	close(release)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, fast.StatusCode)
+	assert.Equal(t, http.StatusOK, (<-slow).StatusCode)
+
+	// the slot is released once the instrumented request is done
+	_, err = app.Test(httptest.NewRequest(http.MethodGet, "/fast", nil), -1)
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), collector.metrics(t, nrApp)["Custom/"+skippedMetricName])
+
+	names := map[interface{}]int{}
+	for _, txn := range collector.events(t, "analytic_event_data") {
+		names[txn.Intrinsics["name"]]++
+	}
+	assert.Equal(t, map[interface{}]int{"WebTransaction/Go/GET /slow": 1, "WebTransaction/Go/GET /fast": 1}, names)
+}
+
+func TestSkipSuccessfulTransactions(t *testing.T) {
+	for _, skip := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, SkipSuccessfulTransactions: skip}))
+		app.Get("/ok", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+		app.Get("/created", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusCreated)
+		})
+		app.Get("/fail", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusInternalServerError)
+		})
+
+		for _, url := range []string{"/ok", "/created", "/fail"} {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+			assert.NoError(t, err)
+		}
+
+		var names []interface{}
+		for _, txn := range collector.transactionEvents(t, nrApp) {
+			names = append(names, txn.Intrinsics["name"])
+		}
+
+		if skip {
+			assert.ElementsMatch(t, []interface{}{"WebTransaction/Go/GET /fail"}, names)
+		} else {
+			assert.Len(t, names, 3)
+		}
+	}
+}
+
+func TestRecordResponseStatusCode(t *testing.T) {
+	for _, record := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordResponseStatusCode: &record}))
+		app.Get("/missing", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusNotFound)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/missing", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /missing")
+		if record {
+			assert.Equal(t, float64(http.StatusNotFound), txn.AgentAttributes["http.statusCode"])
+		} else {
+			assert.NotContains(t, txn.AgentAttributes, "http.statusCode")
+		}
+	}
+}
+
+func TestNRTransactionCategory(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application: nrApp,
+		CategoryExtractor: func(c *fiber.Ctx) string {
+			if c.Path() == "/jobs/cleanup" {
+				return CategoryBackground
+			}
+			return ""
+		},
+	}))
+	app.Post("/jobs/cleanup", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/users", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/jobs/cleanup", nil),
+		httptest.NewRequest(http.MethodGet, "/users", nil),
+	} {
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	var names []interface{}
+	for _, txn := range collector.transactionEvents(t, nrApp) {
+		names = append(names, txn.Intrinsics["name"])
+	}
+	assert.ElementsMatch(t, []interface{}{"OtherTransaction/Go/POST /jobs/cleanup", "WebTransaction/Go/GET /users"}, names)
+}
+
+func TestTransactionCategory(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		assert.Equal(t, CategoryWeb, transactionCategory(ctx, &ConfigDefault))
+		assert.Equal(t, CategoryBackground, transactionCategory(ctx, &Config{NRTransactionCategory: CategoryBackground}))
+		return nil
+	})
+
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+}
+
+func TestStartupTimeout(t *testing.T) {
+	t.Run("should return an error when the application does not connect in time", func(t *testing.T) {
+		nrApp := newDelayedApplication(t, time.Second)
+
+		handler, err := NewE(Config{Application: nrApp, StartupTimeout: 10 * time.Millisecond})
+
+		assert.Error(t, err)
+		assert.Nil(t, handler)
+	})
+
+	t.Run("should shut the created application down when it does not connect in time", func(t *testing.T) {
+		logger := &shutdownLogger{}
+		stubNewApplication(t, logger, time.Second)
+
+		handler, err := NewE(Config{License: testLicense, Enabled: true, StartupTimeout: 10 * time.Millisecond})
+
+		assert.Error(t, err)
+		assert.Nil(t, handler)
+		assert.True(t, logger.shutdown())
+	})
+
+	t.Run("should not shut the configured application down when it does not connect in time", func(t *testing.T) {
+		logger := &shutdownLogger{}
+		stubNewApplication(t, logger, time.Second)
+		nrApp, err := newApplication(newrelic.ConfigAppName("configured"), newrelic.ConfigLicense(testLicense))
+		assert.NoError(t, err)
+		t.Cleanup(func() { nrApp.Shutdown(0) })
+
+		_, err = NewE(Config{Application: nrApp, StartupTimeout: 10 * time.Millisecond})
+
+		assert.Error(t, err)
+		assert.False(t, logger.shutdown())
+	})
+
+	t.Run("should panic in New when the application does not connect in time", func(t *testing.T) {
+		nrApp := newDelayedApplication(t, time.Second)
+
+		assert.Panics(t, func() {
+			New(Config{Application: nrApp, StartupTimeout: 10 * time.Millisecond})
+		})
+	})
+
+	t.Run("should wait for the application to connect", func(t *testing.T) {
+		nrApp := newDelayedApplication(t, 50*time.Millisecond)
+
+		handler, err := NewE(Config{Application: nrApp, StartupTimeout: 5 * time.Second})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, handler)
+	})
+
+	t.Run("should not wait without a startup timeout", func(t *testing.T) {
+		nrApp := newDelayedApplication(t, time.Second)
+
+		handler, err := NewE(Config{Application: nrApp})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, handler)
+	})
+}
+
+// stubNewApplication makes the applications created by the middleware report
+// to an in-memory collector, which delays the connection, and log to logger.
+func stubNewApplication(t *testing.T, logger newrelic.Logger, connectDelay time.Duration) {
+	t.Helper()
+
+	original := newApplication
+	t.Cleanup(func() { newApplication = original })
+
+	newApplication = func(opts ...newrelic.ConfigOption) (*newrelic.Application, error) {
+		tc := &testCollector{collector.New()}
+		tc.ConnectDelay = connectDelay
+		return original(append(opts, func(cfg *newrelic.Config) {
+			cfg.Transport = tc
+			cfg.Logger = logger
+		})...)
+	}
+}
+
+// shutdownLogger is a newrelic.Logger recording whether an application was
+// shut down.
+type shutdownLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *shutdownLogger) Error(msg string, context map[string]interface{}) { l.record(msg) }
+func (l *shutdownLogger) Warn(msg string, context map[string]interface{})  { l.record(msg) }
+func (l *shutdownLogger) Info(msg string, context map[string]interface{})  { l.record(msg) }
+func (l *shutdownLogger) Debug(msg string, context map[string]interface{}) { l.record(msg) }
+func (l *shutdownLogger) DebugEnabled() bool                               { return false }
+
+func (l *shutdownLogger) record(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.messages = append(l.messages, msg)
+}
+
+func (l *shutdownLogger) shutdown() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, msg := range l.messages {
+		if msg == "application shutdown" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFromUserContext(t *testing.T) {
+	t.Run("should return the transaction of the user context", func(t *testing.T) {
+		nrApp, _ := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			derived, cancel := context.WithCancel(ctx.UserContext())
+			defer cancel()
+
+			assert.NotNil(t, FromUserContext(derived))
+			assert.Same(t, FromContext(ctx), FromUserContext(derived))
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should return nil without a transaction", func(t *testing.T) {
+		assert.Nil(t, FromUserContext(context.Background()))
+		assert.Nil(t, FromUserContext(nil))
+	})
+}
+
+func TestNewE(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  Config
+	}{
+		{name: "empty license", cfg: Config{License: ""}},
+		{name: "invalid license length", cfg: Config{License: "invalid_key"}},
+		{name: "invalid event harvest", cfg: Config{
+			License:      "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+			EventHarvest: EventHarvest{ReportPeriod: time.Millisecond},
+		}},
+	} {
+		t.Run("should return an error for "+tt.name, func(t *testing.T) {
+			handler, err := NewE(tt.cfg)
+
+			assert.Error(t, err)
+			assert.Nil(t, handler)
+		})
+	}
+
+	t.Run("should return a handler for a valid config", func(t *testing.T) {
+		handler, err := NewE(Config{License: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"})
+
+		assert.NoError(t, err)
+		assert.NotNil(t, handler)
+	})
+}
+
+func TestNRTestMode(t *testing.T) {
+	// given
+	handler, err := NewE(Config{NRTestMode: true, Enabled: true, StartupTimeout: time.Minute})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(handler)
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		txn := FromContext(ctx)
+		if assert.NotNil(t, txn) {
+			nrCfg, ok := txn.Application().Config()
+			assert.True(t, ok)
+			assert.False(t, nrCfg.Enabled)
+		}
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	start := time.Now()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestWrapFiberApp(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+
+	// when
+	wrapped := WrapFiberApp(app, Config{Application: nrApp})
+	wrapped.Get("/users", func(ctx *fiber.Ctx) error {
+		assert.NotNil(t, FromContext(ctx))
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/users", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Same(t, app, wrapped)
+	findTransaction(t, collector.transactionEvents(t, nrApp), "GET /users")
+}
+
+func TestNamespace(t *testing.T) {
+	// given
+	primaryApp, primaryCollector := newTestApplication(t)
+	secondaryApp, secondaryCollector := newTestApplication(t)
+
+	app := fiber.New()
+	app.Use(New(Config{Application: primaryApp, Namespace: "primary"}))
+	app.Use(New(Config{Application: secondaryApp, Namespace: "secondary"}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		primary, secondary := FromContext(ctx, "primary"), FromContext(ctx, "secondary")
+		assert.NotNil(t, primary)
+		assert.NotNil(t, secondary)
+		assert.NotSame(t, primary, secondary)
+		assert.Same(t, secondary, FromContext(ctx))
+		assert.Nil(t, FromContext(ctx, "unknown"))
+
+		primary.AddAttribute("account", "primary")
+		secondary.AddAttribute("account", "secondary")
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", findTransaction(t, primaryCollector.transactionEvents(t, primaryApp), "GET /").UserAttributes["account"])
+	assert.Equal(t, "secondary", findTransaction(t, secondaryCollector.transactionEvents(t, secondaryApp), "GET /").UserAttributes["account"])
+}
+
+func TestRecordResponseTime(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordResponseTime: true}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		time.Sleep(5 * time.Millisecond)
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+	if assert.IsType(t, float64(0), txn.UserAttributes["response.durationMs"]) {
+		durationMs := txn.UserAttributes["response.durationMs"].(float64)
+		assert.GreaterOrEqual(t, durationMs, float64(5))
+		assert.Equal(t, float64(int64(durationMs)), durationMs)
+	}
+}
+
+func TestRecordStatusCodeClass(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordStatusCodeClass: true}))
+	app.Get("/:status", func(ctx *fiber.Ctx) error {
+		status, err := ctx.ParamsInt("status")
+		if err != nil {
+			return err
+		}
+		return ctx.SendStatus(status)
+	})
+
+	expected := map[int]float64{199: 100, 200: 200, 201: 200, 299: 200, 300: 300, 399: 300, 400: 400, 499: 400, 500: 500, 599: 500}
+
+	// when
+	for status := range expected {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/"+strconv.Itoa(status), nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	for status, class := range expected {
+		txn := findTransaction(t, txns, "GET /"+strconv.Itoa(status))
+		assert.Equal(t, class, txn.UserAttributes["response.statusClass"], status)
+	}
+}
+
+func TestLaggyStartupHandler(t *testing.T) {
+	t.Run("should serve requests with the handler until the application connected", func(t *testing.T) {
+		// given
+		nrApp := newDelayedApplication(t, 200*time.Millisecond)
+
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, LaggyStartupHandler: func(ctx *fiber.Ctx) error {
+			return ctx.Status(http.StatusServiceUnavailable).SendString("starting")
+		}}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendString("ready")
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		assert.NoError(t, nrApp.WaitForConnection(5*time.Second))
+		resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should serve requests normally once the application did not connect in time", func(t *testing.T) {
+		// given
+		nrApp := newDelayedApplication(t, 5*time.Second)
+
+		app := fiber.New()
+		app.Use(New(Config{
+			Application:         nrApp,
+			LaggyStartupTimeout: 50 * time.Millisecond,
+			LaggyStartupHandler: func(ctx *fiber.Ctx) error {
+				return ctx.Status(http.StatusServiceUnavailable).SendString("starting")
+			},
+		}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendString("ready")
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		time.Sleep(100 * time.Millisecond)
+		resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should serve requests normally without handler", func(t *testing.T) {
+		// given
+		nrApp := newDelayedApplication(t, 200*time.Millisecond)
+
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendString("ready")
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestConcurrentRequestsAttribute(t *testing.T) {
+	const concurrency = 5
+
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, ConcurrentRequestsAttribute: true}))
+
+	started := make(chan struct{}, concurrency)
+	release := make(chan struct{})
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		started <- struct{}{}
+		<-release
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+		}()
+	}
+	for i := 0; i < concurrency; i++ {
+		<-started
+	}
+	close(release)
+	wg.Wait()
+
+	// then
+	events := collector.transactionEvents(t, nrApp)
+	assert.Len(t, events, concurrency)
+
+	var highest float64
+	for _, event := range events {
+		n, ok := event.UserAttributes["server.concurrentRequests"].(float64)
+		if assert.True(t, ok) {
+			assert.GreaterOrEqual(t, n, float64(1))
+			assert.LessOrEqual(t, n, float64(concurrency))
+			if n > highest {
+				highest = n
+			}
+		}
+	}
+	assert.Equal(t, float64(concurrency), highest)
+}
@@ -0,0 +1,150 @@
+// Package fibernewrelictest provides helpers for testing handlers instrumented
+// with the fibernewrelic middleware, without any network access.
+package fibernewrelictest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/contrib/fibernewrelic"
+	"github.com/gofiber/contrib/fibernewrelic/internal/collector"
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLicense = "0123456789abcdef0123456789abcdef01234567"
+
+// Transaction is a transaction as reported to New Relic.
+type Transaction struct {
+	// Name is the full transaction name, e.g. "WebTransaction/Go/GET /users".
+	Name string
+	// Attributes are the custom attributes of the transaction.
+	Attributes map[string]interface{}
+	// AgentAttributes are the attributes recorded by the agent, e.g. http.statusCode.
+	AgentAttributes map[string]interface{}
+}
+
+// TestHelper serves requests through the fibernewrelic middleware and reports
+// the New Relic data to an in-memory collector.
+type TestHelper struct {
+	t         *testing.T
+	app       *fiber.App
+	nrApp     *newrelic.Application
+	collector *collector.Collector
+
+	harvestOnce  sync.Once
+	transactions []Transaction
+	errors       []collector.Event
+}
+
+// New creates a TestHelper with the middleware created from cfg. The
+// Application of cfg is replaced by one reporting to the in-memory collector.
+func New(t *testing.T, cfg fibernewrelic.Config) *TestHelper {
+	t.Helper()
+
+	c := collector.New()
+	nrApp, err := newrelic.NewApplication(
+		newrelic.ConfigAppName("fibernewrelictest"),
+		newrelic.ConfigLicense(testLicense),
+		newrelic.ConfigEnabled(true),
+		func(cfg *newrelic.Config) { cfg.Transport = c },
+	)
+	require.NoError(t, err)
+	require.NoError(t, nrApp.WaitForConnection(5*time.Second))
+	t.Cleanup(func() { nrApp.Shutdown(time.Second) })
+
+	cfg.Application = nrApp
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(fibernewrelic.New(cfg))
+
+	return &TestHelper{t: t, app: app, nrApp: nrApp, collector: c}
+}
+
+// App returns the Fiber app with the middleware installed. Register the
+// handlers under test on it.
+func (h *TestHelper) App() *fiber.App {
+	return h.app
+}
+
+// Transactions returns the reported transactions. The first call shuts the
+// New Relic application down to flush its data, so serve all requests before.
+func (h *TestHelper) Transactions() []Transaction {
+	h.t.Helper()
+	h.harvest()
+
+	return h.transactions
+}
+
+// AssertTransactionName asserts a transaction with the given name was reported.
+// The name may omit the "WebTransaction/Go/" or "OtherTransaction/Go/" prefix.
+func (h *TestHelper) AssertTransactionName(t testing.TB, name string) {
+	t.Helper()
+
+	var names []string
+	for _, txn := range h.Transactions() {
+		if matchesName(txn.Name, name) {
+			return
+		}
+		names = append(names, txn.Name)
+	}
+
+	assert.Failf(t, "transaction not found", "no transaction named %q in %q", name, names)
+}
+
+// AssertAttribute asserts a transaction was reported with the custom attribute
+// key set to value. Numbers are compared by value, as the reported attributes
+// are float64.
+func (h *TestHelper) AssertAttribute(t testing.TB, key string, value interface{}) {
+	t.Helper()
+
+	for _, txn := range h.Transactions() {
+		if actual, ok := txn.Attributes[key]; ok && assert.ObjectsAreEqualValues(value, actual) {
+			return
+		}
+	}
+
+	assert.Failf(t, "attribute not found", "no transaction with attribute %q = %#v", key, value)
+}
+
+// AssertError asserts an error with the given message was reported.
+func (h *TestHelper) AssertError(t testing.TB, errMsg string) {
+	t.Helper()
+	h.harvest()
+
+	var messages []interface{}
+	for _, e := range h.errors {
+		if e.Intrinsics["error.message"] == errMsg {
+			return
+		}
+		messages = append(messages, e.Intrinsics["error.message"])
+	}
+
+	assert.Failf(t, "error not found", "no error with message %q in %v", errMsg, messages)
+}
+
+func (h *TestHelper) harvest() {
+	h.harvestOnce.Do(func() {
+		h.nrApp.Shutdown(5 * time.Second)
+
+		for _, e := range h.collector.Events(h.t, "analytic_event_data") {
+			name, _ := e.Intrinsics["name"].(string)
+			h.transactions = append(h.transactions, Transaction{
+				Name:            name,
+				Attributes:      e.UserAttributes,
+				AgentAttributes: e.AgentAttributes,
+			})
+		}
+		h.errors = h.collector.Events(h.t, "error_event_data")
+	})
+}
+
+func matchesName(full, name string) bool {
+	return full == name ||
+		strings.TrimPrefix(full, "WebTransaction/Go/") == name ||
+		strings.TrimPrefix(full, "OtherTransaction/Go/") == name
+}
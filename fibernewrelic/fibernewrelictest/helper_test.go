@@ -0,0 +1,79 @@
+package fibernewrelictest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/contrib/fibernewrelic"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestHelper(t *testing.T) {
+	// given
+	h := New(t, fibernewrelic.Config{UseRoutePath: true})
+	h.App().Get("/users/:id", func(ctx *fiber.Ctx) error {
+		fibernewrelic.AddTransactionAttribute(ctx, "user.id", ctx.Params("id"))
+		fibernewrelic.AddTransactionAttribute(ctx, "user.age", 42)
+		return fiber.NewError(http.StatusNotFound, "user not found")
+	})
+
+	// when
+	resp, err := h.App().Test(httptest.NewRequest(http.MethodGet, "/users/7", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	if assert.Len(t, h.Transactions(), 1) {
+		assert.Equal(t, "WebTransaction/Go/GET /users/:id", h.Transactions()[0].Name)
+		assert.Equal(t, float64(http.StatusNotFound), h.Transactions()[0].AgentAttributes["http.statusCode"])
+	}
+	h.AssertTransactionName(t, "GET /users/:id")
+	h.AssertTransactionName(t, "WebTransaction/Go/GET /users/:id")
+	h.AssertAttribute(t, "user.id", "7")
+	h.AssertAttribute(t, "user.age", 42)
+	h.AssertError(t, "user not found")
+}
+
+func TestTestHelperFailures(t *testing.T) {
+	// given
+	h := New(t, fibernewrelic.Config{})
+	h.App().Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	_, err := h.App().Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+
+	// when
+	recorder := &failureRecorder{TB: t}
+	h.AssertTransactionName(recorder, "GET /missing")
+	h.AssertAttribute(recorder, "missing", "value")
+	h.AssertError(recorder, "missing")
+
+	// then
+	if assert.Len(t, recorder.failures, 3) {
+		assert.Contains(t, recorder.failures[0], `no transaction named "GET /missing"`)
+		assert.Contains(t, recorder.failures[1], `no transaction with attribute "missing" = "value"`)
+		assert.Contains(t, recorder.failures[2], `no error with message "missing"`)
+	}
+	h.AssertTransactionName(t, "GET /")
+}
+
+// failureRecorder is a testing.TB recording the failures reported to it
+// instead of failing the test.
+type failureRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *failureRecorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *failureRecorder) Fatalf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
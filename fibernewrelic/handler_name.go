@@ -0,0 +1,29 @@
+package fibernewrelic
+
+import (
+	"path"
+	"reflect"
+	"runtime"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handlerName returns the fully qualified function name of handler.
+func handlerName(handler fiber.Handler) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); fn != nil {
+		return fn.Name()
+	}
+
+	return ""
+}
+
+// shortHandlerName returns the package-qualified name of handler, e.g.
+// "handlers.GetUser" for "github.com/acme/app/handlers.GetUser".
+func shortHandlerName(handler fiber.Handler) string {
+	name := handlerName(handler)
+	if name == "" {
+		return ""
+	}
+
+	return path.Base(name)
+}
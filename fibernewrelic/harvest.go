@@ -0,0 +1,49 @@
+package fibernewrelic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+const (
+	minEventHarvestReportPeriod = 5 * time.Second
+	maxEventHarvestReportPeriod = 300 * time.Second
+)
+
+// EventHarvest configures the event harvest of the New Relic application
+// created by the middleware.
+type EventHarvest struct {
+	// ReportPeriod is the requested event harvest period, between 5 and 300 seconds.
+	// The go agent uses the period negotiated with the collector, so the value is only
+	// validated
+	// Optional. Default: 0
+	ReportPeriod time.Duration
+	// MaxSamplesStored is the maximum number of transaction events stored per harvest
+	// Optional. Default: 0
+	MaxSamplesStored int
+}
+
+// validate checks the harvest config against the limits of New Relic.
+func (h EventHarvest) validate() error {
+	if h.ReportPeriod != 0 && (h.ReportPeriod < minEventHarvestReportPeriod || h.ReportPeriod > maxEventHarvestReportPeriod) {
+		return fmt.Errorf("EventHarvest.ReportPeriod must be between %s and %s, got %s",
+			minEventHarvestReportPeriod, maxEventHarvestReportPeriod, h.ReportPeriod)
+	}
+
+	if h.MaxSamplesStored < 0 {
+		return fmt.Errorf("EventHarvest.MaxSamplesStored can not be negative, got %d", h.MaxSamplesStored)
+	}
+
+	return nil
+}
+
+// configOption applies the harvest config to the agent config.
+func (h EventHarvest) configOption() newrelic.ConfigOption {
+	return func(cfg *newrelic.Config) {
+		if h.MaxSamplesStored > 0 {
+			cfg.TransactionEvents.MaxSamplesStored = h.MaxSamplesStored
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package fibernewrelic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventHarvestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		harvest EventHarvest
+		valid   bool
+	}{
+		{name: "zero value", harvest: EventHarvest{}, valid: true},
+		{name: "minimum report period", harvest: EventHarvest{ReportPeriod: 5 * time.Second}, valid: true},
+		{name: "maximum report period", harvest: EventHarvest{ReportPeriod: 300 * time.Second}, valid: true},
+		{name: "report period too short", harvest: EventHarvest{ReportPeriod: 5*time.Second - time.Millisecond}, valid: false},
+		{name: "report period too long", harvest: EventHarvest{ReportPeriod: 300*time.Second + time.Millisecond}, valid: false},
+		{name: "negative max samples", harvest: EventHarvest{MaxSamplesStored: -1}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.harvest.validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestEventHarvestConfig(t *testing.T) {
+	t.Run("should set the max samples stored", func(t *testing.T) {
+		cfg := newrelic.Config{}
+		EventHarvest{MaxSamplesStored: 100}.configOption()(&cfg)
+		assert.Equal(t, 100, cfg.TransactionEvents.MaxSamplesStored)
+	})
+
+	t.Run("should panic on invalid config", func(t *testing.T) {
+		assert.PanicsWithError(t, "unable to create New Relic Application -> EventHarvest.ReportPeriod must be between 5s and 5m0s, got 1s", func() {
+			New(Config{License: testLicense, EventHarvest: EventHarvest{ReportPeriod: time.Second}})
+		})
+	})
+}
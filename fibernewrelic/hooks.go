@@ -0,0 +1,31 @@
+package fibernewrelic
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// Hooks defines callbacks which are executed during the transaction lifecycle.
+type Hooks struct {
+	// BeforeTransaction is called just after the transaction has been started
+	// Optional. Default: nil
+	BeforeTransaction func(c *fiber.Ctx, txn *newrelic.Transaction)
+	// AfterTransaction is called after the transaction has been ended
+	// Optional. Default: nil
+	AfterTransaction func(c *fiber.Ctx, txn *newrelic.Transaction, elapsed time.Duration, statusCode int)
+}
+
+// runHook executes fn and recovers from any panic within it, so a faulty hook
+// can not break the request.
+func runHook(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("fibernewrelic: recovered from panic in %s hook: %v", name, r)
+		}
+	}()
+
+	fn()
+}
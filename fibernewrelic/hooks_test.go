@@ -0,0 +1,146 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	t.Run("should call hooks around the transaction", func(t *testing.T) {
+		// given
+		var (
+			calls      []string
+			beforeTxn  *newrelic.Transaction
+			afterTxn   *newrelic.Transaction
+			elapsed    time.Duration
+			statusCode int
+		)
+
+		app := fiber.New()
+		app.Use(New(Config{
+			License: testLicense,
+			Hooks: Hooks{
+				BeforeTransaction: func(c *fiber.Ctx, txn *newrelic.Transaction) {
+					calls = append(calls, "before")
+					beforeTxn = txn
+				},
+				AfterTransaction: func(c *fiber.Ctx, txn *newrelic.Transaction, e time.Duration, code int) {
+					calls = append(calls, "after")
+					afterTxn, elapsed, statusCode = txn, e, code
+				},
+			},
+		}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			calls = append(calls, "handler")
+			time.Sleep(5 * time.Millisecond)
+			return ctx.SendStatus(http.StatusAccepted)
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, []string{"before", "handler", "after"}, calls)
+		assert.NotNil(t, beforeTxn)
+		assert.Same(t, beforeTxn, afterTxn)
+		assert.GreaterOrEqual(t, elapsed, 5*time.Millisecond)
+		assert.Equal(t, http.StatusAccepted, statusCode)
+	})
+
+	t.Run("should recover from panics in hooks", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(New(Config{
+			License: testLicense,
+			Hooks: Hooks{
+				BeforeTransaction: func(c *fiber.Ctx, txn *newrelic.Transaction) { panic("before") },
+				AfterTransaction: func(c *fiber.Ctx, txn *newrelic.Transaction, e time.Duration, code int) {
+					panic("after")
+				},
+			},
+		}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestPostTransactionHook(t *testing.T) {
+	// given
+	var txns []*newrelic.Transaction
+
+	nrApp, _ := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application: nrApp,
+		PostTransactionHook: func(txn *newrelic.Transaction, c *fiber.Ctx) {
+			txns = append(txns, txn)
+		},
+	}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for i := 0; i < 2; i++ {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	if assert.Len(t, txns, 2) {
+		assert.NotNil(t, txns[0])
+		assert.NotNil(t, txns[1])
+		assert.NotSame(t, txns[0], txns[1])
+	}
+}
+
+func TestSlowHandlerCallback(t *testing.T) {
+	// given
+	var slow []string
+
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application:          nrApp,
+		SlowRequestThreshold: 20 * time.Millisecond,
+		SlowHandlerCallback: func(c *fiber.Ctx, elapsed time.Duration) {
+			assert.Greater(t, elapsed, 20*time.Millisecond)
+			slow = append(slow, utils.CopyString(c.Path()))
+			panic("faulty callback")
+		},
+	}))
+	app.Get("/slow", func(ctx *fiber.Ctx) error {
+		time.Sleep(30 * time.Millisecond)
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/fast", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, url := range []string{"/slow", "/fast"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// then
+	assert.Equal(t, []string{"/slow"}, slow)
+
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, true, findTransaction(t, txns, "GET /slow").UserAttributes["request.slow"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /fast").UserAttributes, "request.slow")
+}
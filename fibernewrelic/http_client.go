@@ -0,0 +1,65 @@
+package fibernewrelic
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/valyala/fasthttp"
+)
+
+// FastHTTPClient is a fasthttp.Client whose Do calls are reported as external
+// segments of the transaction of the request it was wrapped for. Only Do is
+// instrumented, the helpers of the embedded client are not.
+type FastHTTPClient struct {
+	*fasthttp.Client
+
+	ctx *fiber.Ctx
+}
+
+// WrapFastHTTPClient wraps client so its requests are reported as external
+// segments when Config.HTTPClientWrapper is true. The wrapper is bound to the
+// current request and must not be used after the handler returns.
+func WrapFastHTTPClient(c *fiber.Ctx, client *fasthttp.Client) *FastHTTPClient {
+	return &FastHTTPClient{Client: client, ctx: c}
+}
+
+// Do performs the request within an external segment, adding the distributed
+// trace headers, and the request ID with Config.TagAllWithRequestID, to the
+// outgoing request.
+func (fc *FastHTTPClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	state := getRequestState(fc.ctx)
+	if state == nil || !state.cfg.HTTPClientWrapper {
+		return fc.Client.Do(req, resp)
+	}
+
+	// The segment is started first, so the headers carry its span ID.
+	txn := state.segmentTransaction()
+	seg := &newrelic.ExternalSegment{
+		StartTime: txn.StartSegmentNow(),
+		URL:       req.URI().String(),
+		Procedure: string(req.Header.Method()),
+	}
+
+	hdrs := http.Header{}
+	state.txn.InsertDistributedTraceHeaders(hdrs)
+	formatOutboundHeaders(hdrs, state.cfg.TraceContextPropagation)
+	for key := range hdrs {
+		req.Header.Set(key, hdrs.Get(key))
+	}
+	if id := outboundRequestID(fc.ctx, state.cfg); id != "" {
+		req.Header.Set(fiber.HeaderXRequestID, id)
+	}
+
+	if name := formatSegmentName(state.cfg, seg); name != "" {
+		seg.Procedure = name
+	}
+	defer seg.End()
+
+	err := fc.Client.Do(req, resp)
+	if err == nil {
+		seg.SetStatusCode(resp.StatusCode())
+	}
+
+	return err
+}
@@ -0,0 +1,111 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestWrapFastHTTPClient(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		payload []string
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		payload = append(payload, r.Header.Get(newrelicHeader))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+
+	for _, enabled := range []bool{true, false} {
+		// given
+		payload = nil
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, HTTPClientWrapper: enabled}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			client := WrapFastHTTPClient(ctx, &fasthttp.Client{})
+			for i := 0; i < 2; i++ {
+				req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+				req.SetRequestURI(upstream.URL)
+				err := client.Do(req, resp)
+				assert.Equal(t, http.StatusAccepted, resp.StatusCode())
+				fasthttp.ReleaseRequest(req)
+				fasthttp.ReleaseResponse(resp)
+				if err != nil {
+					return err
+				}
+			}
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		metrics := collector.metrics(t, nrApp)
+		assert.Len(t, payload, 2)
+		if enabled {
+			assert.Equal(t, float64(2), metrics["External/all"])
+			assert.NotContains(t, payload, "")
+		} else {
+			assert.NotContains(t, metrics, "External/all")
+			assert.Equal(t, []string{"", ""}, payload)
+		}
+	}
+}
+
+func TestWrapFastHTTPClientSpanID(t *testing.T) {
+	// given
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, HTTPClientWrapper: true}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		req, resp := fasthttp.AcquireRequest(), fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(upstream.URL)
+		if err := WrapFastHTTPClient(ctx, &fasthttp.Client{}).Do(req, resp); err != nil {
+			return err
+		}
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+
+	// traceparent is "00-<trace id>-<span id>-<flags>".
+	parts := strings.Split(traceparent, "-")
+	require.Len(t, parts, 4)
+
+	collector.harvest(nrApp)
+	var guids []interface{}
+	for _, span := range collector.events(t, "span_event_data") {
+		if span.Intrinsics["category"] == "http" {
+			guids = append(guids, span.Intrinsics["guid"])
+		}
+	}
+	assert.Equal(t, []interface{}{parts[2]}, guids)
+}
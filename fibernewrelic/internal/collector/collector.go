@@ -0,0 +1,107 @@
+// Package collector provides an in-memory stand-in for the New Relic
+// collector, shared by the fibernewrelic tests and fibernewrelictest.
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Collector is used as the agent transport so the harvested data can be
+// asserted without any network access.
+type Collector struct {
+	mu       sync.Mutex
+	payloads map[string][][]byte
+	// ConnectDelay delays the reply to the connect call.
+	ConnectDelay time.Duration
+}
+
+// Event is a single transaction, error, span or custom event as sent to the
+// collector.
+type Event struct {
+	Intrinsics      map[string]interface{}
+	UserAttributes  map[string]interface{}
+	AgentAttributes map[string]interface{}
+}
+
+// New creates an empty Collector.
+func New() *Collector {
+	return &Collector{payloads: map[string][][]byte{}}
+}
+
+// RoundTrip records the uncompressed payload of the request, keyed by the
+// collector method, and replies as the collector would.
+func (c *Collector) RoundTrip(r *http.Request) (*http.Response, error) {
+	method := r.URL.Query().Get("method")
+
+	var body []byte
+	if zr, err := gzip.NewReader(r.Body); err == nil {
+		body, _ = io.ReadAll(zr)
+	}
+
+	c.mu.Lock()
+	c.payloads[method] = append(c.payloads[method], body)
+	c.mu.Unlock()
+
+	if method == "connect" && c.ConnectDelay > 0 {
+		time.Sleep(c.ConnectDelay)
+	}
+
+	reply := `{"return_value":{}}`
+	switch method {
+	case "preconnect":
+		reply = `{"return_value":{"redirect_host":"collector.test"}}`
+	case "connect":
+		reply = `{"return_value":{"agent_run_id":"test-run","account_id":"123","trusted_account_key":"123","primary_application_id":"456"}}`
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewBufferString(reply)),
+		Request:    r,
+	}, nil
+}
+
+// Payloads returns the payloads sent to the collector method, e.g. "metric_data".
+func (c *Collector) Payloads(method string) [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([][]byte(nil), c.payloads[method]...)
+}
+
+// Events returns the events sent to the collector method, e.g.
+// "analytic_event_data".
+func (c *Collector) Events(t testing.TB, method string) []Event {
+	t.Helper()
+
+	var events []Event
+	for _, payload := range c.Payloads(method) {
+		var data []json.RawMessage
+		require.NoError(t, json.Unmarshal(payload, &data))
+		require.Len(t, data, 3)
+
+		var raw [][]map[string]interface{}
+		require.NoError(t, json.Unmarshal(data[2], &raw))
+
+		for _, event := range raw {
+			require.Len(t, event, 3)
+			events = append(events, Event{
+				Intrinsics:      event[0],
+				UserAttributes:  event[1],
+				AgentAttributes: event[2],
+			})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,74 @@
+package fibernewrelic
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// CustomMetric is a custom metric returned by Config.CustomMetricsFromRequest.
+type CustomMetric struct {
+	Name  string
+	Value float64
+}
+
+// RecordCustomMetric records a custom metric on the New Relic application of
+// the current request. It is a no-op when the request is not instrumented.
+func RecordCustomMetric(c *fiber.Ctx, name string, value float64) {
+	state := getRequestState(c)
+	if state == nil {
+		return
+	}
+
+	recordCustomMetric(state.txn.Application(), state.cfg, name, value)
+}
+
+const (
+	// skippedMetricName is the custom metric counting requests served without a
+	// transaction because of Config.LimitConcurrentTransactions.
+	skippedMetricName = "FibernewrelicSkipped"
+	// slowQueryEventType is the custom event type recorded by RecordSlowQuery.
+	slowQueryEventType = "SlowQuery"
+	// slowQueryMaxSQLLength is the maximum length of the SQL recorded by
+	// RecordSlowQuery, so that the SQL and the appended "..." fit in the 255
+	// bytes limit of custom event attributes.
+	slowQueryMaxSQLLength = 252
+)
+
+// RecordSlowQuery records a query timed outside of a datastore segment, as the
+// Custom/SlowQuery/<dbName> metric and a SlowQuery custom event holding the
+// truncated SQL. It is a no-op when the request is not instrumented.
+func RecordSlowQuery(c *fiber.Ctx, sql, dbName string, elapsed time.Duration) {
+	state := getRequestState(c)
+	if state == nil {
+		return
+	}
+
+	app := state.txn.Application()
+	recordCustomMetric(app, state.cfg, "SlowQuery/"+dbName, elapsed.Seconds())
+	app.RecordCustomEvent(slowQueryEventType, map[string]interface{}{
+		"sql":      truncateString(sql, slowQueryMaxSQLLength),
+		"dbName":   dbName,
+		"duration": elapsed.Seconds(),
+	})
+}
+
+// recordCustomMetric is the single place custom metrics are recorded, so that
+// every metric honours the metric related config.
+func recordCustomMetric(app *newrelic.Application, cfg *Config, name string, value float64) {
+	name = cfg.MetricsPrefix + name
+	if cfg.MetricNameFormatter != nil {
+		name = cfg.MetricNameFormatter(name)
+	}
+
+	app.RecordCustomMetric(name, value)
+}
+
+// PrefixMetricFormatter returns a MetricNameFormatter which prepends prefix to
+// every metric name, e.g. "Team/Service/" for Custom/Team/Service/<name>.
+func PrefixMetricFormatter(prefix string) func(name string) string {
+	return func(name string) string {
+		return prefix + name
+	}
+}
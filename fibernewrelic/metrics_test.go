@@ -0,0 +1,103 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordCustomMetric(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		formatter func(string) string
+		expected  string
+	}{
+		{name: "without prefix", prefix: "", expected: "Custom/queue/depth"},
+		{name: "with prefix", prefix: "tenant-a/", expected: "Custom/tenant-a/queue/depth"},
+		{name: "with formatter", formatter: PrefixMetricFormatter("Team/Service/"), expected: "Custom/Team/Service/queue/depth"},
+		{name: "with prefix and formatter", prefix: "tenant-a/", formatter: strings.ToUpper, expected: "Custom/TENANT-A/QUEUE/DEPTH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, MetricsPrefix: tt.prefix, MetricNameFormatter: tt.formatter}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				RecordCustomMetric(ctx, "queue/depth", 3)
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Contains(t, collector.metrics(t, nrApp), tt.expected)
+		})
+	}
+}
+
+func TestRecordSlowQuery(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		RecordSlowQuery(ctx, "SELECT * FROM users WHERE id = "+strings.Repeat("1", 2000), "users", 1500*time.Millisecond)
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.Contains(t, collector.metrics(t, nrApp), "Custom/SlowQuery/users")
+
+	events := collector.events(t, "custom_event_data")
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, slowQueryEventType, events[0].Intrinsics["type"])
+		assert.Equal(t, "users", events[0].UserAttributes["dbName"])
+		assert.Equal(t, 1.5, events[0].UserAttributes["duration"])
+
+		sql := events[0].UserAttributes["sql"].(string)
+		assert.True(t, strings.HasPrefix(sql, "SELECT * FROM users"))
+		assert.Len(t, sql, slowQueryMaxSQLLength+len("..."))
+	}
+}
+
+func TestCustomMetricsFromRequest(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{
+		Application:   nrApp,
+		MetricsPrefix: "api/",
+		CustomMetricsFromRequest: func(c *fiber.Ctx) []CustomMetric {
+			return []CustomMetric{
+				{Name: "request/size", Value: float64(len(c.Body()))},
+				{Name: "queue/depth", Value: 7},
+			}
+		},
+	}))
+	app.Post("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload")), -1)
+
+	// then
+	assert.NoError(t, err)
+	totals := collector.metricTotals(t, nrApp)
+	assert.Equal(t, float64(len("payload")), totals["Custom/api/request/size"])
+	assert.Equal(t, float64(7), totals["Custom/api/queue/depth"])
+}
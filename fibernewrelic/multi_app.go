@@ -0,0 +1,92 @@
+package fibernewrelic
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// NewMultiApp instruments the Fiber app with multiple New Relic applications,
+// e.g. to report to a staging and a production account during a migration.
+//
+// The first config is the primary one: it is used exactly like with New, and
+// its transaction is the one returned by FromContext. The other configs are
+// only used to create the secondary applications, which receive the same
+// transaction name, web request, noticed errors and status code as the primary
+// transaction, and are ignored when the primary middleware skipped or ignored
+// the request. A secondary application which can not be created is logged
+// and skipped.
+func NewMultiApp(cfgs ...Config) fiber.Handler {
+	if len(cfgs) == 0 {
+		panic("fibernewrelic: NewMultiApp requires at least one config")
+	}
+
+	primaryCfg := cfgs[0]
+	primary := New(primaryCfg)
+
+	namespace := primaryCfg.Namespace
+	if namespace == "" {
+		namespace = ConfigDefault.Namespace
+	}
+	stateKey := namespaceStateKey(namespace)
+
+	secondaries := make([]*newrelic.Application, 0, len(cfgs)-1)
+	for i := range cfgs[1:] {
+		cfg := cfgs[i+1]
+
+		app, err := createApplication(&cfg)
+		if err != nil {
+			log.Errorf("fibernewrelic: skipping secondary New Relic application %q: %v", cfg.AppName, err)
+			continue
+		}
+
+		// Like the other middleware options, the drain is configured by the primary config.
+		if drainEnabled(&primaryCfg) {
+			drainer.register(app, primaryCfg.DrainTimeout)
+		}
+
+		secondaries = append(secondaries, app)
+	}
+
+	return func(c *fiber.Ctx) error {
+		if len(secondaries) == 0 || (primaryCfg.Next != nil && primaryCfg.Next(c)) {
+			return primary(c)
+		}
+
+		var (
+			name = createTransactionName(c)
+			req  = newRequestInfo(c, primaryCfg.UseImmutableContext)
+			txns = make([]*newrelic.Transaction, len(secondaries))
+		)
+
+		for i, app := range secondaries {
+			txns[i] = app.StartTransaction(name)
+			txns[i].SetWebRequest(req.webRequest())
+		}
+
+		// The deferred function also runs when a next handler panicked, after the
+		// primary middleware recorded its final status code.
+		defer func() {
+			// The primary middleware has no state when it skipped the request,
+			// e.g. with LimitConcurrentTransactions.
+			state, _ := c.Locals(stateKey).(*requestState)
+
+			for _, txn := range txns {
+				if state == nil || state.ignored {
+					txn.Ignore()
+					txn.End()
+					continue
+				}
+
+				txn.SetName(state.txn.Name())
+				for _, noticed := range state.noticedErrors() {
+					txn.NoticeError(noticed)
+				}
+				txn.SetWebResponse(nil).WriteHeader(state.statusCode)
+				txn.End()
+			}
+		}()
+
+		return primary(c)
+	}
+}
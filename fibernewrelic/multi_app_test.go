@@ -0,0 +1,165 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMultiApp(t *testing.T) {
+	t.Run("should report to every application", func(t *testing.T) {
+		// given
+		primaryApp, primaryCollector := newTestApplication(t)
+		secondaryApp, secondaryCollector := newTestApplication(t)
+
+		app := fiber.New()
+		app.Use(NewMultiApp(
+			Config{Application: primaryApp, UseRoutePath: true},
+			Config{Application: secondaryApp},
+		))
+		app.Get("/users/:id", func(ctx *fiber.Ctx) error {
+			assert.Equal(t, primaryApp.Private, FromContext(ctx).Application().Private)
+			return fiber.ErrTeapot
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/users/42", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+		for _, txns := range [][]harvestedEvent{
+			primaryCollector.transactionEvents(t, primaryApp),
+			secondaryCollector.transactionEvents(t, secondaryApp),
+		} {
+			txn := findTransaction(t, txns, "GET /users/:id")
+			assert.Equal(t, float64(http.StatusTeapot), txn.AgentAttributes["http.statusCode"])
+			assert.Equal(t, true, txn.Intrinsics["error"])
+		}
+	})
+
+	t.Run("should report panics like the primary application", func(t *testing.T) {
+		for name, cfg := range map[string]Config{
+			"raised again":     {RecoverPanics: true},
+			"recovered":        {GracefulPanicRecover: true},
+			"without recovery": {},
+		} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				primaryApp, primaryCollector := newTestApplication(t)
+				secondaryApp, secondaryCollector := newTestApplication(t)
+
+				cfg.Application = primaryApp
+				app := fiber.New()
+				app.Use(recover.New())
+				app.Use(NewMultiApp(cfg, Config{Application: secondaryApp}))
+				app.Get("/panic", func(ctx *fiber.Ctx) error {
+					panic("boom")
+				})
+
+				// when
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/panic", nil), -1)
+
+				// then
+				assert.NoError(t, err)
+				assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+				primaryErrors := errorClasses(primaryCollector.errorEvents(t, primaryApp))
+				assert.ElementsMatch(t, primaryErrors, errorClasses(secondaryCollector.errorEvents(t, secondaryApp)))
+				if cfg.RecoverPanics || cfg.GracefulPanicRecover {
+					assert.Contains(t, primaryErrors, panicErrorClass)
+				}
+
+				for _, txns := range [][]harvestedEvent{
+					primaryCollector.transactionEvents(t, primaryApp),
+					secondaryCollector.transactionEvents(t, secondaryApp),
+				} {
+					txn := findTransaction(t, txns, "GET /panic")
+					assert.Equal(t, float64(http.StatusInternalServerError), txn.AgentAttributes["http.statusCode"])
+				}
+			})
+		}
+	})
+
+	t.Run("should skip the requests skipped by the primary application", func(t *testing.T) {
+		// given
+		primaryApp, primaryCollector := newTestApplication(t)
+		secondaryApp, secondaryCollector := newTestApplication(t)
+
+		app := fiber.New()
+		app.Use(NewMultiApp(
+			Config{Application: primaryApp, LimitConcurrentTransactions: 1, SkipSuccessfulTransactions: true},
+			Config{Application: secondaryApp},
+		))
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		app.Get("/slow", func(ctx *fiber.Ctx) error {
+			close(started)
+			<-release
+			return ctx.SendStatus(http.StatusBadGateway)
+		})
+		app.Get("/fast", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusBadGateway)
+		})
+		app.Get("/ok", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		// when
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/slow", nil), -1)
+			assert.NoError(t, err)
+		}()
+		<-started
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/fast", nil), -1)
+		assert.NoError(t, err)
+		close(release)
+		<-done
+
+		_, err = app.Test(httptest.NewRequest(http.MethodGet, "/ok", nil), -1)
+		assert.NoError(t, err)
+
+		// then
+		for _, txns := range [][]harvestedEvent{
+			primaryCollector.transactionEvents(t, primaryApp),
+			secondaryCollector.transactionEvents(t, secondaryApp),
+		} {
+			if assert.Len(t, txns, 1) {
+				assert.Equal(t, "WebTransaction/Go/GET /slow", txns[0].Intrinsics["name"])
+			}
+		}
+	})
+
+	t.Run("should skip secondary applications which can not be created", func(t *testing.T) {
+		primaryApp, primaryCollector := newTestApplication(t)
+
+		var handler fiber.Handler
+		assert.NotPanics(t, func() {
+			handler = NewMultiApp(Config{Application: primaryApp}, Config{License: ""})
+		})
+
+		app := fiber.New()
+		app.Use(handler)
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		findTransaction(t, primaryCollector.transactionEvents(t, primaryApp), "GET /")
+	})
+
+	t.Run("should panic without config", func(t *testing.T) {
+		assert.Panics(t, func() { NewMultiApp() })
+	})
+}
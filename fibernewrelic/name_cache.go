@@ -0,0 +1,85 @@
+package fibernewrelic
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// nameCache is a goroutine-safe LRU cache of transaction names.
+type nameCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type nameCacheEntry struct {
+	key   string
+	value string
+}
+
+func newNameCache(size int) *nameCache {
+	return &nameCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (nc *nameCache) get(key string) (string, bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if el, ok := nc.items[key]; ok {
+		nc.ll.MoveToFront(el)
+		return el.Value.(*nameCacheEntry).value, true
+	}
+
+	return "", false
+}
+
+func (nc *nameCache) add(key, value string) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	if el, ok := nc.items[key]; ok {
+		nc.ll.MoveToFront(el)
+		el.Value.(*nameCacheEntry).value = value
+		return
+	}
+
+	nc.items[key] = nc.ll.PushFront(&nameCacheEntry{key: key, value: value})
+
+	if nc.ll.Len() > nc.size {
+		oldest := nc.ll.Back()
+		nc.ll.Remove(oldest)
+		delete(nc.items, oldest.Value.(*nameCacheEntry).key)
+	}
+}
+
+func (nc *nameCache) len() int {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	return nc.ll.Len()
+}
+
+// routeTransactionName returns the route based transaction name, using the
+// cache when it is enabled.
+func routeTransactionName(c *fiber.Ctx, separator string, cache *nameCache) string {
+	if cache == nil {
+		return createRouteTransactionName(c, separator)
+	}
+
+	key := string(c.Request().Header.Method()) + " " + c.Route().Path
+	if name, ok := cache.get(key); ok {
+		return name
+	}
+
+	name := createRouteTransactionName(c, separator)
+	cache.add(key, name)
+
+	return name
+}
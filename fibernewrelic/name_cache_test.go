@@ -0,0 +1,66 @@
+package fibernewrelic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameCache(t *testing.T) {
+	t.Run("should return cached values", func(t *testing.T) {
+		cache := newNameCache(2)
+		cache.add("GET /users", "GET /users")
+
+		name, ok := cache.get("GET /users")
+		assert.True(t, ok)
+		assert.Equal(t, "GET /users", name)
+
+		_, ok = cache.get("GET /orders")
+		assert.False(t, ok)
+	})
+
+	t.Run("should not exceed the configured size", func(t *testing.T) {
+		cache := newNameCache(2)
+		cache.add("a", "a")
+		cache.add("b", "b")
+		cache.get("a")
+		cache.add("c", "c")
+
+		assert.Equal(t, 2, cache.len())
+		_, ok := cache.get("b")
+		assert.False(t, ok, "least recently used entry should be evicted")
+		_, ok = cache.get("a")
+		assert.True(t, ok)
+	})
+}
+
+func TestTransactionNameCacheSize(t *testing.T) {
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, UseRoutePath: true, TransactionNameCacheSize: 1}))
+	app.Get("/users/:id", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/orders/:id", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	for _, url := range []string{"/users/1", "/users/2", "/orders/1", "/users/3"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	names := map[string]int{}
+	for _, txn := range collector.transactionEvents(t, nrApp) {
+		names[fmt.Sprint(txn.Intrinsics["name"])]++
+	}
+
+	assert.Equal(t, map[string]int{
+		"WebTransaction/Go/GET /users/:id":  3,
+		"WebTransaction/Go/GET /orders/:id": 1,
+	}, names)
+}
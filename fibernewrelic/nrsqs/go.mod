@@ -0,0 +1,26 @@
+module github.com/gofiber/contrib/fibernewrelic/nrsqs
+
+go 1.18
+
+replace github.com/gofiber/contrib/fibernewrelic => ../
+
+require (
+	github.com/aws/aws-sdk-go-v2/service/sqs v1.24.6
+	github.com/gofiber/contrib/fibernewrelic v1.0.0
+	github.com/newrelic/go-agent/v3 v3.33.1
+	github.com/stretchr/testify v1.9.0
+)
+
+require (
+	github.com/aws/smithy-go v1.15.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.23.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/grpc v1.56.3 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
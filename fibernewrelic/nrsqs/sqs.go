@@ -0,0 +1,53 @@
+// Package nrsqs instruments the processing of SQS messages with New Relic. It
+// is a separate module so the fibernewrelic middleware does not depend on the
+// AWS SDK.
+package nrsqs
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// WrapSQSMessage instruments the processing of SQS messages received from
+// queueURL. Each message is processed within its own background transaction,
+// linked to the producer when the message attributes carry the distributed
+// trace headers. The transaction is available from the context passed to fn,
+// and the error returned by fn is reported.
+func WrapSQSMessage(app *newrelic.Application, queueURL string, fn func(ctx context.Context, msg types.Message) error) func(ctx context.Context, msg types.Message) error {
+	queueName := queueURL[strings.LastIndex(queueURL, "/")+1:]
+
+	return func(ctx context.Context, msg types.Message) error {
+		txn := app.StartTransaction("SQS/Queue/Named/" + queueName)
+		defer txn.End()
+
+		txn.AcceptDistributedTraceHeaders(newrelic.TransportQueue, sqsMessageHeaders(msg))
+		txn.AddAttribute("message.queueName", queueName)
+		if msg.MessageId != nil {
+			txn.AddAttribute("message.messageId", *msg.MessageId)
+		}
+
+		err := fn(newrelic.NewContext(ctx, txn), msg)
+		if err != nil {
+			txn.NoticeError(err)
+		}
+
+		return err
+	}
+}
+
+// sqsMessageHeaders returns the string message attributes as headers, from
+// which the distributed trace headers are read.
+func sqsMessageHeaders(msg types.Message) http.Header {
+	hdrs := http.Header{}
+	for name, attr := range msg.MessageAttributes {
+		if attr.StringValue != nil {
+			hdrs.Set(name, *attr.StringValue)
+		}
+	}
+
+	return hdrs
+}
@@ -0,0 +1,80 @@
+package nrsqs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gofiber/contrib/fibernewrelic/internal/collector"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapSQSMessage(t *testing.T) {
+	// given
+	c := collector.New()
+	nrApp, err := newrelic.NewApplication(
+		newrelic.ConfigAppName("nrsqs-test"),
+		newrelic.ConfigLicense("0123456789abcdef0123456789abcdef01234567"),
+		newrelic.ConfigEnabled(true),
+		func(cfg *newrelic.Config) { cfg.Transport = c },
+	)
+	require.NoError(t, err)
+	require.NoError(t, nrApp.WaitForConnection(5*time.Second))
+
+	upstream := nrApp.StartTransaction("upstream")
+	hdrs := http.Header{}
+	upstream.InsertDistributedTraceHeaders(hdrs)
+	traceID := upstream.GetTraceMetadata().TraceID
+	upstream.End()
+
+	attributes := map[string]types.MessageAttributeValue{}
+	for name := range hdrs {
+		value := hdrs.Get(name)
+		attributes[name] = types.MessageAttributeValue{DataType: newString("String"), StringValue: &value}
+	}
+
+	var processed []string
+	handler := WrapSQSMessage(nrApp, "https://sqs.eu-west-1.amazonaws.com/123/orders", func(ctx context.Context, msg types.Message) error {
+		assert.NotNil(t, newrelic.FromContext(ctx))
+		processed = append(processed, *msg.Body)
+		if *msg.Body == "invalid" {
+			return errors.New("invalid order")
+		}
+		return nil
+	})
+
+	// when
+	assert.NoError(t, handler(context.Background(), types.Message{MessageId: newString("1"), Body: newString("order"), MessageAttributes: attributes}))
+	assert.EqualError(t, handler(context.Background(), types.Message{MessageId: newString("2"), Body: newString("invalid")}), "invalid order")
+
+	// then
+	assert.Equal(t, []string{"order", "invalid"}, processed)
+
+	nrApp.Shutdown(5 * time.Second)
+
+	var txns []collector.Event
+	for _, txn := range c.Events(t, "analytic_event_data") {
+		if txn.Intrinsics["name"] == "OtherTransaction/Go/SQS/Queue/Named/orders" {
+			txns = append(txns, txn)
+		}
+	}
+	if assert.Len(t, txns, 2) {
+		byID := map[interface{}]collector.Event{}
+		for _, txn := range txns {
+			assert.Equal(t, "orders", txn.UserAttributes["message.queueName"])
+			byID[txn.UserAttributes["message.messageId"]] = txn
+		}
+		assert.Equal(t, traceID, byID["1"].Intrinsics["traceId"])
+		assert.NotEqual(t, traceID, byID["2"].Intrinsics["traceId"])
+		assert.Equal(t, true, byID["2"].Intrinsics["error"])
+	}
+}
+
+func newString(s string) *string {
+	return &s
+}
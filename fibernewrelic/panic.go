@@ -0,0 +1,102 @@
+package fibernewrelic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// panicErrorClass is the New Relic error class of recovered panics.
+const panicErrorClass = "panic"
+
+// newPanicError creates the error reported for a recovered panic. At most
+// depth stack frames are captured, both in the error message and in the stack
+// trace reported to New Relic.
+func newPanicError(recovered interface{}, depth int) newrelic.Error {
+	pcs := make([]uintptr, depth)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+
+	return newrelic.Error{
+		Message: fmt.Sprintf("%v\n%s", recovered, formatStack(pcs)),
+		Class:   panicErrorClass,
+		Stack:   pcs,
+	}
+}
+
+// recordPanicType records the type of a recovered panic value as panic.type,
+// e.g. "*runtime.TypeAssertionError", and the value as panic.value.
+func recordPanicType(txn *newrelic.Transaction, cfg *Config, recovered interface{}) {
+	addAttribute(txn, cfg, "panic.type", reflect.TypeOf(recovered).String())
+	addAttribute(txn, cfg, "panic.value", fmt.Sprintf("%v", recovered))
+}
+
+func formatStack(pcs []uintptr) string {
+	var (
+		sb     strings.Builder
+		frames = runtime.CallersFrames(pcs)
+	)
+
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+
+		if !more {
+			break
+		}
+	}
+
+	return sb.String()
+}
+
+// panicDeduplicator tracks the stack traces of panics already reported to New
+// Relic. Entries older than ttl are reported again; a zero ttl never expires.
+type panicDeduplicator struct {
+	ttl  time.Duration
+	seen sync.Map
+}
+
+func newPanicDeduplicator(ttl time.Duration) *panicDeduplicator {
+	return &panicDeduplicator{ttl: ttl}
+}
+
+// shouldNotify reports whether a panic with the given stack trace should be
+// sent to New Relic.
+func (d *panicDeduplicator) shouldNotify(pcs []uintptr) bool {
+	var (
+		key = stackHash(pcs)
+		now = time.Now()
+	)
+
+	seen, loaded := d.seen.LoadOrStore(key, now)
+	if !loaded {
+		return true
+	}
+
+	if d.ttl > 0 && now.Sub(seen.(time.Time)) >= d.ttl {
+		d.seen.Store(key, now)
+		return true
+	}
+
+	return false
+}
+
+func stackHash(pcs []uintptr) uint64 {
+	var (
+		h   = fnv.New64a()
+		buf [8]byte
+	)
+
+	for _, pc := range pcs {
+		binary.LittleEndian.PutUint64(buf[:], uint64(pc))
+		_, _ = h.Write(buf[:])
+	}
+
+	return h.Sum64()
+}
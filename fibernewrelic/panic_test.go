@@ -0,0 +1,265 @@
+package fibernewrelic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPanicError(t *testing.T) {
+	for _, depth := range []int{1, 3, 32} {
+		err := newPanicError("boom", depth)
+
+		assert.Equal(t, panicErrorClass, err.Class)
+		assert.LessOrEqual(t, len(err.Stack), depth)
+		assert.True(t, strings.HasPrefix(err.Message, "boom\n"))
+		assert.LessOrEqual(t, strings.Count(err.Message, "\n\t"), depth)
+	}
+}
+
+func TestPanicDeduplicator(t *testing.T) {
+	t.Run("should only notify the first occurrence of a stack trace", func(t *testing.T) {
+		d := newPanicDeduplicator(0)
+
+		assert.True(t, d.shouldNotify([]uintptr{1, 2, 3}))
+		assert.False(t, d.shouldNotify([]uintptr{1, 2, 3}))
+		assert.True(t, d.shouldNotify([]uintptr{1, 2, 4}))
+	})
+
+	t.Run("should notify again after the ttl", func(t *testing.T) {
+		d := newPanicDeduplicator(10 * time.Millisecond)
+
+		assert.True(t, d.shouldNotify([]uintptr{1}))
+		assert.False(t, d.shouldNotify([]uintptr{1}))
+		time.Sleep(20 * time.Millisecond)
+		assert.True(t, d.shouldNotify([]uintptr{1}))
+		assert.False(t, d.shouldNotify([]uintptr{1}))
+	})
+}
+
+func TestRecoverPanics(t *testing.T) {
+	t.Run("should report the panic and raise it again", func(t *testing.T) {
+		// given
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(recover.New())
+		app.Use(New(Config{Application: nrApp, RecoverPanics: true, PanicStackDepth: 4}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			panic("boom")
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+		var panicEvent *harvestedEvent
+		events := collector.errorEvents(t, nrApp)
+		for i := range events {
+			if events[i].Intrinsics["error.class"] == panicErrorClass {
+				panicEvent = &events[i]
+			}
+		}
+
+		if assert.NotNil(t, panicEvent) {
+			message := panicEvent.Intrinsics["error.message"].(string)
+			assert.True(t, strings.HasPrefix(message, "boom\n"))
+			assert.LessOrEqual(t, strings.Count(message, "\n\t"), 4)
+			assert.Equal(t, float64(http.StatusInternalServerError), panicEvent.AgentAttributes["http.statusCode"])
+		}
+	})
+
+	t.Run("should not recover panics by default", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(recover.New())
+		app.Use(New(Config{Application: nrApp}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			panic("boom")
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.NotContains(t, errorClasses(collector.errorEvents(t, nrApp)), panicErrorClass)
+	})
+	t.Run("should report repeated panics once with PanicNotifyOnce", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(recover.New())
+		app.Use(New(Config{Application: nrApp, RecoverPanics: true, PanicNotifyOnce: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			panic("boom")
+		})
+
+		for i := 0; i < 3; i++ {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		}
+
+		var panics int
+		for _, class := range errorClasses(collector.errorEvents(t, nrApp)) {
+			if class == panicErrorClass {
+				panics++
+			}
+		}
+		assert.Equal(t, 1, panics)
+	})
+}
+
+func TestGracefulPanicRecover(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     []byte
+		expected string
+	}{
+		{name: "should respond with the default body", body: nil, expected: "Internal Server Error"},
+		{name: "should respond with the configured body", body: []byte(`{"error":"internal"}`), expected: `{"error":"internal"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, GracefulPanicRecover: true, PanicResponseBody: tt.body}))
+			app.Get("/panic", func(ctx *fiber.Ctx) error {
+				ctx.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				_ = ctx.SendString("partial")
+				panic("boom")
+			})
+			app.Get("/ok", func(ctx *fiber.Ctx) error {
+				return ctx.SendString("ok")
+			})
+
+			// when
+			for i := 0; i < 2; i++ {
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/panic", nil), -1)
+
+				// then
+				if assert.NoError(t, err) {
+					assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+					body, err := io.ReadAll(resp.Body)
+					assert.NoError(t, err)
+					assert.Equal(t, tt.expected, string(body))
+				}
+			}
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ok", nil), -1)
+			if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+
+			var panics int
+			for _, class := range errorClasses(collector.errorEvents(t, nrApp)) {
+				if class == panicErrorClass {
+					panics++
+				}
+			}
+			assert.Equal(t, 2, panics)
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /panic")
+			assert.Equal(t, float64(http.StatusInternalServerError), txn.AgentAttributes["http.statusCode"])
+		})
+	}
+}
+
+type testPanicError struct{ reason string }
+
+func (e *testPanicError) Error() string { return e.reason }
+
+func TestRecordPanicType(t *testing.T) {
+	tests := []struct {
+		name      string
+		panic     func()
+		typeName  string
+		valueName string
+	}{
+		{name: "should record a string panic", panic: func() { panic("boom") }, typeName: "string", valueName: "boom"},
+		{name: "should record an error panic", panic: func() { panic(&testPanicError{reason: "broken"}) }, typeName: "*fibernewrelic.testPanicError", valueName: "broken"},
+		{
+			name: "should record a runtime panic",
+			panic: func() {
+				var v interface{} = 42
+				_ = v.(string)
+			},
+			typeName:  "*runtime.TypeAssertionError",
+			valueName: "interface conversion: interface {} is int, not string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, GracefulPanicRecover: true, RecordPanicType: true}))
+			app.Get("/panic", func(ctx *fiber.Ctx) error {
+				tt.panic()
+				return nil
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/panic", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+
+			attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /panic").UserAttributes
+			assert.Equal(t, tt.typeName, attrs["panic.type"])
+			assert.Equal(t, tt.valueName, attrs["panic.value"])
+		})
+	}
+}
+
+func TestFallbackStatusCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback int
+		expected int
+	}{
+		{name: "should report 500 by default", fallback: 0, expected: http.StatusInternalServerError},
+		{name: "should report the configured status code", fallback: http.StatusServiceUnavailable, expected: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			var hookStatus int
+
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(recover.New())
+			app.Use(New(Config{
+				Application:        nrApp,
+				FallbackStatusCode: tt.fallback,
+				Hooks: Hooks{AfterTransaction: func(c *fiber.Ctx, txn *newrelic.Transaction, elapsed time.Duration, statusCode int) {
+					hookStatus = statusCode
+				}},
+			}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				panic("boom")
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, hookStatus)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, float64(tt.expected), txn.AgentAttributes["http.statusCode"])
+		})
+	}
+}
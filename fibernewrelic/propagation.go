@@ -0,0 +1,170 @@
+package fibernewrelic
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+const (
+	// PropagationNewRelic propagates the trace context in the New Relic newrelic header.
+	PropagationNewRelic = "newrelic"
+	// PropagationW3C propagates the trace context in the W3C traceparent and tracestate
+	// headers.
+	PropagationW3C = "w3c"
+	// PropagationB3 propagates the trace context in the Zipkin single b3 header.
+	PropagationB3 = "b3"
+	// PropagationB3Multi propagates the trace context in the Zipkin X-B3-* headers.
+	PropagationB3Multi = "b3multi"
+	// PropagationAuto reads the first trace context found, trying W3C, New Relic, B3 and
+	// B3 multi in turn, and writes both the W3C and New Relic headers.
+	PropagationAuto = "auto"
+)
+
+const (
+	tracestateHeader = "tracestate"
+	b3Header         = "b3"
+	b3TraceIDHeader  = "X-B3-TraceId"
+	b3SpanIDHeader   = "X-B3-SpanId"
+	b3SampledHeader  = "X-B3-Sampled"
+	b3FlagsHeader    = "X-B3-Flags"
+)
+
+// validatePropagation returns an error for an unknown
+// Config.TraceContextPropagation.
+func validatePropagation(propagation string) error {
+	switch propagation {
+	case "", PropagationNewRelic, PropagationW3C, PropagationB3, PropagationB3Multi, PropagationAuto:
+		return nil
+	default:
+		return fmt.Errorf("unable to create New Relic Application -> unknown TraceContextPropagation %q", propagation)
+	}
+}
+
+// stripTraceContextHeaders removes the trace context headers understood by
+// the agent from hdrs, so that only the configured propagation format is
+// accepted.
+func stripTraceContextHeaders(hdrs http.Header) {
+	for _, name := range []string{newrelicHeader, traceparentHeader, tracestateHeader} {
+		hdrs.Del(name)
+	}
+}
+
+// acceptPropagatedHeaders accepts the trace context of the request in the
+// given propagation format. B3 contexts are converted to a W3C traceparent.
+func acceptPropagatedHeaders(c *fiber.Ctx, txn *newrelic.Transaction, propagation string, transportType newrelic.TransportType) {
+	formats := []string{propagation}
+	if propagation == PropagationAuto {
+		formats = []string{PropagationW3C, PropagationNewRelic, PropagationB3, PropagationB3Multi}
+	}
+
+	for _, format := range formats {
+		if hdrs := inboundTraceContext(c, format); hdrs != nil {
+			txn.AcceptDistributedTraceHeaders(transportType, hdrs)
+			return
+		}
+	}
+}
+
+// inboundTraceContext returns the trace context of the request in the given
+// format as headers understood by the agent, or nil when there is none.
+func inboundTraceContext(c *fiber.Ctx, format string) http.Header {
+	hdrs := http.Header{}
+
+	switch format {
+	case PropagationNewRelic:
+		if value := c.Get(newrelicHeader); value != "" {
+			hdrs.Set(newrelicHeader, value)
+			return hdrs
+		}
+	case PropagationW3C:
+		if value := c.Get(traceparentHeader); value != "" {
+			hdrs.Set(traceparentHeader, value)
+			if state := c.Get(tracestateHeader); state != "" {
+				hdrs.Set(tracestateHeader, state)
+			}
+			return hdrs
+		}
+	case PropagationB3:
+		// b3: {TraceId}-{SpanId}-{SamplingState}-{ParentSpanId}, where only the
+		// trace and span IDs are required.
+		parts := strings.Split(c.Get(b3Header), "-")
+		if len(parts) >= 2 {
+			sampled := ""
+			if len(parts) >= 3 {
+				sampled = parts[2]
+			}
+			if value := b3Traceparent(parts[0], parts[1], sampled == "1" || sampled == "d"); value != "" {
+				hdrs.Set(traceparentHeader, value)
+				return hdrs
+			}
+		}
+	case PropagationB3Multi:
+		sampled := c.Get(b3SampledHeader) == "1" || c.Get(b3FlagsHeader) == "1"
+		if value := b3Traceparent(c.Get(b3TraceIDHeader), c.Get(b3SpanIDHeader), sampled); value != "" {
+			hdrs.Set(traceparentHeader, value)
+			return hdrs
+		}
+	}
+
+	return nil
+}
+
+// b3Traceparent converts B3 trace and span IDs to a W3C traceparent value.
+// 64-bit trace IDs are left padded to 128 bits. It returns "" for invalid IDs.
+func b3Traceparent(traceID, spanID string, sampled bool) string {
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+
+	value := "00-" + strings.ToLower(traceID) + "-" + strings.ToLower(spanID) + "-" + flags
+	if !traceparentPattern.MatchString(value) {
+		return ""
+	}
+
+	return value
+}
+
+// formatOutboundHeaders rewrites the distributed trace headers inserted by
+// the agent into hdrs in the given propagation format. B3 headers are derived
+// from the W3C traceparent.
+func formatOutboundHeaders(hdrs http.Header, propagation string) {
+	switch propagation {
+	case PropagationNewRelic:
+		hdrs.Del(traceparentHeader)
+		hdrs.Del(tracestateHeader)
+	case PropagationW3C:
+		hdrs.Del(newrelicHeader)
+	case PropagationB3, PropagationB3Multi:
+		traceparent := hdrs.Get(traceparentHeader)
+		stripTraceContextHeaders(hdrs)
+
+		if !traceparentPattern.MatchString(traceparent) {
+			return
+		}
+
+		// traceparent: {version}-{trace-id}-{parent-id}-{trace-flags}
+		parts := strings.Split(traceparent, "-")
+		sampled := "0"
+		if parts[3] == "01" {
+			sampled = "1"
+		}
+
+		if propagation == PropagationB3 {
+			hdrs.Set(b3Header, parts[1]+"-"+parts[2]+"-"+sampled)
+			return
+		}
+
+		hdrs.Set(b3TraceIDHeader, parts[1])
+		hdrs.Set(b3SpanIDHeader, parts[2])
+		hdrs.Set(b3SampledHeader, sampled)
+	}
+}
@@ -0,0 +1,216 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceContextPropagationInbound(t *testing.T) {
+	const (
+		b3TraceID = "463ac35c9f6413ad48485a3953bb6124"
+		b3Short   = "48485a3953bb6124"
+		b3SpanID  = "a2fb4a1d1a96d312"
+	)
+
+	tests := []struct {
+		name        string
+		propagation string
+		headers     func(upstream http.Header) map[string]string
+		// expected is the expected trace ID, or the trace ID of the upstream
+		// transaction when empty.
+		expected string
+		linked   bool
+	}{
+		{
+			name:        "should read the newrelic header",
+			propagation: PropagationNewRelic,
+			headers: func(upstream http.Header) map[string]string {
+				return map[string]string{newrelicHeader: upstream.Get(newrelicHeader)}
+			},
+			linked: true,
+		},
+		{
+			name:        "should read the w3c headers",
+			propagation: PropagationW3C,
+			headers: func(upstream http.Header) map[string]string {
+				return map[string]string{traceparentHeader: upstream.Get(traceparentHeader), tracestateHeader: upstream.Get(tracestateHeader)}
+			},
+			linked: true,
+		},
+		{
+			name:        "should ignore other formats",
+			propagation: PropagationW3C,
+			headers: func(upstream http.Header) map[string]string {
+				return map[string]string{newrelicHeader: upstream.Get(newrelicHeader)}
+			},
+			linked: false,
+		},
+		{
+			name:        "should read the b3 header",
+			propagation: PropagationB3,
+			headers: func(http.Header) map[string]string {
+				return map[string]string{b3Header: b3TraceID + "-" + b3SpanID + "-1"}
+			},
+			expected: b3TraceID,
+			linked:   true,
+		},
+		{
+			name:        "should pad 64-bit b3 trace IDs",
+			propagation: PropagationB3,
+			headers: func(http.Header) map[string]string {
+				return map[string]string{b3Header: b3Short + "-" + b3SpanID}
+			},
+			expected: "0000000000000000" + b3Short,
+			linked:   true,
+		},
+		{
+			name:        "should read the b3 multi headers",
+			propagation: PropagationB3Multi,
+			headers: func(http.Header) map[string]string {
+				return map[string]string{b3TraceIDHeader: b3TraceID, b3SpanIDHeader: b3SpanID, b3SampledHeader: "1"}
+			},
+			expected: b3TraceID,
+			linked:   true,
+		},
+		{
+			name:        "should detect the newrelic header",
+			propagation: PropagationAuto,
+			headers: func(upstream http.Header) map[string]string {
+				return map[string]string{newrelicHeader: upstream.Get(newrelicHeader)}
+			},
+			linked: true,
+		},
+		{
+			name:        "should detect the b3 header",
+			propagation: PropagationAuto,
+			headers: func(http.Header) map[string]string {
+				return map[string]string{b3Header: b3TraceID + "-" + b3SpanID + "-1"}
+			},
+			expected: b3TraceID,
+			linked:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			upstream, traceID := upstreamHeaders(t, nrApp)
+			if tt.expected != "" {
+				traceID = tt.expected
+			}
+
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, TraceContextPropagation: tt.propagation, UseImmutableContext: true}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range tt.headers(upstream) {
+				req.Header.Set(key, value)
+			}
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			if tt.linked {
+				assert.Equal(t, traceID, txn.Intrinsics["traceId"])
+			} else {
+				assert.NotEqual(t, traceID, txn.Intrinsics["traceId"])
+			}
+		})
+	}
+}
+
+func TestTraceContextPropagationOutbound(t *testing.T) {
+	tests := []struct {
+		propagation string
+		present     []string
+		absent      []string
+	}{
+		{propagation: "", present: []string{newrelicHeader, traceparentHeader, tracestateHeader}},
+		{propagation: PropagationAuto, present: []string{newrelicHeader, traceparentHeader, tracestateHeader}},
+		{propagation: PropagationNewRelic, present: []string{newrelicHeader}, absent: []string{traceparentHeader, tracestateHeader}},
+		{propagation: PropagationW3C, present: []string{traceparentHeader, tracestateHeader}, absent: []string{newrelicHeader}},
+		{propagation: PropagationB3, present: []string{b3Header}, absent: []string{newrelicHeader, traceparentHeader, tracestateHeader}},
+		{propagation: PropagationB3Multi, present: []string{b3TraceIDHeader, b3SpanIDHeader, b3SampledHeader}, absent: []string{newrelicHeader, traceparentHeader}},
+	}
+
+	for _, tt := range tests {
+		t.Run("propagation "+tt.propagation, func(t *testing.T) {
+			// given
+			nrApp, _ := newTestApplication(t)
+
+			var (
+				outbound http.Header
+				traceID  string
+			)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, TraceContextPropagation: tt.propagation}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				req, err := http.NewRequest(http.MethodGet, "http://downstream.test/", nil)
+				if err != nil {
+					return err
+				}
+				StartExternalSegment(ctx, req).End()
+				outbound = req.Header
+				traceID = FromContext(ctx).GetTraceMetadata().TraceID
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+			for _, name := range tt.present {
+				assert.NotEmpty(t, outbound.Get(name), name)
+			}
+			for _, name := range tt.absent {
+				assert.Empty(t, outbound.Get(name), name)
+			}
+
+			switch tt.propagation {
+			case PropagationB3:
+				assert.Regexp(t, "^"+traceID+"-[0-9a-f]{16}-[01]$", outbound.Get(b3Header))
+			case PropagationB3Multi:
+				assert.Equal(t, traceID, outbound.Get(b3TraceIDHeader))
+			}
+		})
+	}
+}
+
+func TestTraceContextPropagationValidation(t *testing.T) {
+	handler, err := NewE(Config{
+		License:                 "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF",
+		TraceContextPropagation: "jaeger",
+	})
+
+	assert.Error(t, err)
+	assert.Nil(t, handler)
+}
+
+func TestB3Traceparent(t *testing.T) {
+	for _, tt := range []struct {
+		traceID  string
+		spanID   string
+		sampled  bool
+		expected string
+	}{
+		{traceID: "463AC35C9F6413AD48485A3953BB6124", spanID: "a2fb4a1d1a96d312", sampled: true, expected: "00-463ac35c9f6413ad48485a3953bb6124-a2fb4a1d1a96d312-01"},
+		{traceID: "48485a3953bb6124", spanID: "a2fb4a1d1a96d312", sampled: false, expected: "00-000000000000000048485a3953bb6124-a2fb4a1d1a96d312-00"},
+		{traceID: "invalid", spanID: "a2fb4a1d1a96d312", expected: ""},
+		{traceID: "463ac35c9f6413ad48485a3953bb6124", spanID: "", expected: ""},
+	} {
+		assert.Equal(t, tt.expected, b3Traceparent(tt.traceID, tt.spanID, tt.sampled), tt.traceID)
+	}
+}
@@ -0,0 +1,72 @@
+package fibernewrelic
+
+import (
+	"strings"
+)
+
+// http2PushURLs returns the URLs of the Link header values which an HTTP/2
+// server or proxy pushes: the links with rel=preload and without nopush.
+func http2PushURLs(values [][]byte) []string {
+	var urls []string
+	for _, value := range values {
+		for _, link := range splitLinks(string(value)) {
+			if url, ok := pushedLink(link); ok {
+				urls = append(urls, url)
+			}
+		}
+	}
+
+	return urls
+}
+
+// splitLinks splits a Link header value at the commas between links, keeping
+// commas within the <URI-Reference> of a link.
+func splitLinks(value string) []string {
+	var (
+		links []string
+		start int
+		inURI bool
+	)
+	for i, r := range value {
+		switch r {
+		case '<':
+			inURI = true
+		case '>':
+			inURI = false
+		case ',':
+			if !inURI {
+				links = append(links, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(links, value[start:])
+}
+
+// pushedLink returns the URL of a single link if it is pushed.
+func pushedLink(link string) (string, bool) {
+	parts := strings.Split(link, ";")
+
+	url := strings.TrimSpace(parts[0])
+	if !strings.HasPrefix(url, "<") || !strings.HasSuffix(url, ">") {
+		return "", false
+	}
+
+	preload := false
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "nopush":
+			return "", false
+		case "rel":
+			for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+				if strings.EqualFold(rel, "preload") {
+					preload = true
+				}
+			}
+		}
+	}
+
+	return url[1 : len(url)-1], preload
+}
@@ -0,0 +1,58 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordHTTP2Push(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordHTTP2Push: true}))
+	app.Get("/push", func(ctx *fiber.Ctx) error {
+		ctx.Response().Header.Add(fiber.HeaderLink, "</app.css>; rel=preload; as=style, </app.js>; rel=preload; as=script; nopush")
+		ctx.Response().Header.Add(fiber.HeaderLink, `</font.woff2>; rel="preload"; as=font`)
+		ctx.Response().Header.Add(fiber.HeaderLink, "</next>; rel=next")
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/none", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, url := range []string{"/push", "/none"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, "/app.css,/font.woff2", findTransaction(t, txns, "GET /push").UserAttributes["response.http2Push"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /none").UserAttributes, "response.http2Push")
+}
+
+func TestHTTP2PushURLs(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		urls  []string
+	}{
+		{name: "preload", value: "</a.css>; rel=preload", urls: []string{"/a.css"}},
+		{name: "nopush", value: "</a.css>; rel=preload; nopush", urls: nil},
+		{name: "other relation", value: "</a.css>; rel=stylesheet", urls: nil},
+		{name: "multiple relations", value: `</a.css>; rel="prefetch preload"`, urls: []string{"/a.css"}},
+		{name: "comma within the URL", value: "</a,b.css>; rel=preload, </c.js>; rel=preload", urls: []string{"/a,b.css", "/c.js"}},
+		{name: "invalid link", value: "a.css; rel=preload", urls: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.urls, http2PushURLs([][]byte{[]byte(tt.value)}))
+		})
+	}
+}
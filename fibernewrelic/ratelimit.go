@@ -0,0 +1,42 @@
+package fibernewrelic
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// rateLimitHeaders maps the rate limit response headers, as set by the Fiber
+// limiter middleware, to the attributes recorded by Config.RecordRateLimitHeaders.
+var rateLimitHeaders = []struct {
+	header    string
+	attribute string
+}{
+	{header: "X-RateLimit-Remaining", attribute: "response.rateLimitRemaining"},
+	{header: "X-RateLimit-Reset", attribute: "response.rateLimitReset"},
+	{header: fiber.HeaderRetryAfter, attribute: "response.retryAfter"},
+}
+
+// recordRateLimitHeaders records the rate limit headers of the response
+// allowed by headers, as integers when they hold a number of requests or
+// seconds, and response.rateLimited on 429 responses.
+func recordRateLimitHeaders(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config, headers headerFilter, statusCode int) {
+	for _, h := range rateLimitHeaders {
+		value := headers.response(c, h.header)
+		if value == "" {
+			continue
+		}
+
+		// Retry-After may also hold an HTTP date, recorded as is.
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			addAttribute(txn, cfg, h.attribute, n)
+		} else {
+			addAttribute(txn, cfg, h.attribute, value)
+		}
+	}
+
+	if statusCode == fiber.StatusTooManyRequests {
+		addAttribute(txn, cfg, "response.rateLimited", true)
+	}
+}
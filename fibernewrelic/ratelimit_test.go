@@ -0,0 +1,63 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRateLimitHeaders(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordRateLimitHeaders: true}))
+	app.Get("/allowed", func(ctx *fiber.Ctx) error {
+		ctx.Set("X-RateLimit-Remaining", "9")
+		ctx.Set("X-RateLimit-Reset", "30")
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Get("/limited", func(ctx *fiber.Ctx) error {
+		ctx.Set("X-RateLimit-Remaining", "0")
+		ctx.Set(fiber.HeaderRetryAfter, "30")
+		return ctx.SendStatus(http.StatusTooManyRequests)
+	})
+	app.Get("/date", func(ctx *fiber.Ctx) error {
+		ctx.Set(fiber.HeaderRetryAfter, "Wed, 21 Oct 2015 07:28:00 GMT")
+		return ctx.SendStatus(http.StatusServiceUnavailable)
+	})
+	app.Get("/none", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, url := range []string{"/allowed", "/limited", "/date", "/none"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+
+	attrs := findTransaction(t, txns, "GET /allowed").UserAttributes
+	assert.Equal(t, float64(9), attrs["response.rateLimitRemaining"])
+	assert.Equal(t, float64(30), attrs["response.rateLimitReset"])
+	assert.NotContains(t, attrs, "response.retryAfter")
+	assert.NotContains(t, attrs, "response.rateLimited")
+
+	attrs = findTransaction(t, txns, "GET /limited").UserAttributes
+	assert.Equal(t, float64(0), attrs["response.rateLimitRemaining"])
+	assert.Equal(t, float64(30), attrs["response.retryAfter"])
+	assert.Equal(t, true, attrs["response.rateLimited"])
+
+	attrs = findTransaction(t, txns, "GET /date").UserAttributes
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", attrs["response.retryAfter"])
+	assert.NotContains(t, attrs, "response.rateLimited")
+
+	attrs = findTransaction(t, txns, "GET /none").UserAttributes
+	for _, h := range rateLimitHeaders {
+		assert.NotContains(t, attrs, h.attribute)
+	}
+}
@@ -0,0 +1,362 @@
+package fibernewrelic
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// maxAcceptHeaderLength is the length the Accept header recorded by
+// Config.RecordAcceptHeader is truncated to.
+const maxAcceptHeaderLength = 256
+
+// maxRefererLength is the length the Referer header recorded by
+// Config.RecordReferer is truncated to.
+const maxRefererLength = 512
+
+// defaultHeaderDenyList are the request headers not recorded by
+// Config.RecordRequestHeaders by default, as they commonly carry credentials.
+var defaultHeaderDenyList = []string{
+	fiber.HeaderAuthorization,
+	fiber.HeaderProxyAuthorization,
+	fiber.HeaderCookie,
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Csrf-Token",
+	"X-Xsrf-Token",
+}
+
+// requestInfo holds copies of the request fields reported to New Relic, so
+// they remain valid when the fiber.Ctx is reused by Fiber.
+type requestInfo struct {
+	host     string
+	method   string
+	scheme   string
+	path     string
+	rawQuery string
+	header   http.Header
+}
+
+// newRequestInfo captures the request fields. Headers are only captured when
+// copyHeaders is true.
+func newRequestInfo(c *fiber.Ctx, copyHeaders bool) requestInfo {
+	info := requestInfo{
+		host:     utils.CopyString(c.Hostname()),
+		method:   utils.CopyString(c.Method()),
+		scheme:   string(c.Request().URI().Scheme()),
+		path:     string(c.Request().URI().Path()),
+		rawQuery: string(c.Request().URI().QueryString()),
+	}
+
+	if copyHeaders {
+		info.header = http.Header{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			info.header.Add(string(key), string(value))
+		})
+	}
+
+	return info
+}
+
+func (r requestInfo) transport() newrelic.TransportType {
+	return transport(r.scheme)
+}
+
+func (r requestInfo) webRequest() newrelic.WebRequest {
+	return newrelic.WebRequest{
+		Header:    r.header,
+		Host:      r.host,
+		Method:    r.method,
+		Transport: r.transport(),
+		URL: &url.URL{
+			Host:     r.host,
+			Scheme:   r.scheme,
+			Path:     r.path,
+			RawQuery: r.rawQuery,
+		},
+	}
+}
+
+// port returns the server port of the request host, or the default port of
+// the scheme when the host has none.
+func (r requestInfo) port() int {
+	if _, port, err := net.SplitHostPort(r.host); err == nil {
+		if n, err := strconv.Atoi(port); err == nil {
+			return n
+		}
+	}
+
+	if r.scheme == "https" {
+		return 443
+	}
+
+	return 80
+}
+
+// parseTrustedProxies parses the IP addresses and CIDR ranges of
+// Config.TrustedProxies.
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("fibernewrelic: invalid trusted proxy %q", proxy)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("fibernewrelic: invalid trusted proxy %q", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// forwardedClientIP returns the rightmost address of an X-Forwarded-For value
+// which is not one of the trusted proxies, or the leftmost address when all of
+// them are trusted.
+func forwardedClientIP(header string, trusted []*net.IPNet) string {
+	if header == "" {
+		return ""
+	}
+
+	hops := strings.Split(header, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if !isTrustedProxy(hop, trusted) {
+			return hop
+		}
+	}
+
+	return strings.TrimSpace(hops[0])
+}
+
+func isTrustedProxy(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acceptsMediaType reports whether the media type of contentType is accepted
+// by an Accept header, including wildcard media ranges. An empty Accept header
+// accepts any media type.
+func acceptsMediaType(accept, contentType string) bool {
+	if accept == "" {
+		return true
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if mediaType == "" {
+		return false
+	}
+	mainType := strings.SplitN(mediaType, "/", 2)[0]
+
+	for _, spec := range strings.Split(accept, ",") {
+		params := strings.Split(spec, ";")
+		if rejectsMediaRange(params[1:]) {
+			continue
+		}
+
+		switch mediaRange := strings.ToLower(strings.TrimSpace(params[0])); mediaRange {
+		case "*/*", mediaType, mainType + "/*":
+			return true
+		}
+	}
+
+	return false
+}
+
+// rejectsMediaRange reports whether the parameters of an Accept media range
+// have a zero quality, which marks the media range as not acceptable.
+func rejectsMediaRange(params []string) bool {
+	for _, param := range params {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.TrimSpace(key) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return err == nil && q == 0
+		}
+	}
+
+	return false
+}
+
+// cookieNames returns the comma-separated names of the request cookies.
+func cookieNames(c *fiber.Ctx) string {
+	var names []string
+	c.Request().Header.VisitAllCookie(func(key, _ []byte) {
+		names = append(names, string(key))
+	})
+
+	return strings.Join(names, ",")
+}
+
+// pathDepth returns the number of non-empty segments of path.
+func pathDepth(path string) int {
+	depth := 0
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			depth++
+		}
+	}
+
+	return depth
+}
+
+// stripReferer removes the fragment of the referer URL, and its query unless
+// includeQuery is set.
+func stripReferer(referer string, includeQuery bool) string {
+	referer, _, _ = strings.Cut(referer, "#")
+	if !includeQuery {
+		referer, _, _ = strings.Cut(referer, "?")
+	}
+
+	return referer
+}
+
+// lowerSet returns the lower cased names, for case insensitive lookups of
+// header or parameter names.
+func lowerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[utils.ToLower(name)] = true
+	}
+
+	return set
+}
+
+// headerFilter filters the headers recorded by the header recording
+// features, from Config.AllowlistHeaders and Config.DenylistHeaders.
+type headerFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func newHeaderFilter(allow, deny []string) headerFilter {
+	return headerFilter{allow: lowerSet(allow), deny: lowerSet(deny)}
+}
+
+// allowed reports whether the header may be recorded. Denied headers are never
+// recorded, and only allowed headers are when the allowlist is not empty.
+func (f headerFilter) allowed(name string) bool {
+	name = utils.ToLower(name)
+	if f.deny[name] {
+		return false
+	}
+
+	return len(f.allow) == 0 || f.allow[name]
+}
+
+// request returns the request header, or "" when it may not be recorded.
+func (f headerFilter) request(c *fiber.Ctx, name string) string {
+	if !f.allowed(name) {
+		return ""
+	}
+
+	return c.Get(name)
+}
+
+// response returns the response header, or "" when it may not be recorded.
+func (f headerFilter) response(c *fiber.Ctx, name string) string {
+	if !f.allowed(name) {
+		return ""
+	}
+
+	return c.GetRespHeader(name)
+}
+
+// recordRequestHeaders records every request header not in deny and allowed by
+// headers as request.header.<name>, with the name lower cased.
+func recordRequestHeaders(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config, deny map[string]bool, headers headerFilter) {
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		name := utils.ToLower(string(key))
+		if deny[name] || !headers.allowed(name) {
+			return
+		}
+
+		addAttribute(txn, cfg, "request.header."+name, string(value))
+	})
+}
+
+// requestSize returns the size of the request line and headers as received,
+// plus the size of the body, counted up to maxBody bytes. The body size is the
+// Content-Length when known, and the size of the buffered body otherwise.
+// Streamed bodies without Content-Length are not counted, to not read them.
+func requestSize(c *fiber.Ctx, maxBody int64) int64 {
+	size := int64(len(c.Request().Header.Header()))
+
+	body := int64(c.Request().Header.ContentLength())
+	if body < 0 {
+		body = 0
+		if !c.Request().IsBodyStream() {
+			body = int64(len(c.Request().Body()))
+		}
+	}
+	if body > maxBody {
+		body = maxBody
+	}
+
+	return size + body
+}
+
+// responseSize returns the size of the status line and headers of the
+// response, plus the size of the body. Buffered bodies are counted by their
+// actual size rather than their Content-Length header. Streamed bodies are
+// sent after the transaction ended, so only the ones of known size are counted.
+func responseSize(c *fiber.Ctx) int64 {
+	resp := c.Response()
+	size := int64(len(resp.Header.Header()))
+
+	if !resp.IsBodyStream() {
+		return size + int64(len(resp.Body()))
+	}
+	if n := resp.Header.ContentLength(); n > 0 {
+		size += int64(n)
+	}
+
+	return size
+}
+
+// redactedPathParameter replaces the values of the path parameters in
+// Config.PathParameterDenyList.
+const redactedPathParameter = "<redacted>"
+
+// recordPathParameters records the path parameters of the matched route as
+// request.parameters.<name>, with the value of the parameters in deny replaced
+// by redactedPathParameter.
+func recordPathParameters(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config, deny map[string]bool) {
+	for _, name := range c.Route().Params {
+		value := c.Params(name)
+		if deny[utils.ToLower(name)] {
+			value = redactedPathParameter
+		}
+
+		addAttribute(txn, cfg, "request.parameters."+name, value)
+	}
+}
@@ -0,0 +1,741 @@
+package fibernewrelic
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseImmutableContextHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		reported bool
+	}{
+		{name: "should report the headers", cfg: Config{UseImmutableContext: true}, reported: true},
+		{name: "should not report the headers by default", cfg: Config{}, reported: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			cfg := tt.cfg
+			cfg.Application = nrApp
+			app := fiber.New()
+			app.Use(New(cfg))
+			app.Get("/users", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users?page=1", nil)
+			req.Header.Set(fiber.HeaderAccept, "application/json")
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /users")
+			if tt.reported {
+				assert.Equal(t, "application/json", txn.AgentAttributes["request.headers.accept"])
+			} else {
+				assert.NotContains(t, txn.AgentAttributes, "request.headers.accept")
+			}
+		})
+	}
+}
+
+func TestRequestFieldsCopied(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, UseImmutableContext: true}))
+
+	returned := make(chan struct{})
+	var wg sync.WaitGroup
+	app.Get("/users", func(ctx *fiber.Ctx) error {
+		txn := FromContext(ctx).NewGoroutine()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Runs once the handler returned and the fiber.Ctx was reused.
+			<-returned
+			txn.StartSegment("async").End()
+		}()
+
+		return ctx.SendStatus(http.StatusOK)
+	})
+	app.Post("/orders", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusCreated)
+	})
+
+	first := httptest.NewRequest(http.MethodGet, "/users?page=1", nil)
+	first.Header.Set(fiber.HeaderAccept, "application/json")
+	second := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	second.Header.Set(fiber.HeaderAccept, "text/plain")
+
+	// when
+	_, err := app.Test(first, -1)
+	assert.NoError(t, err)
+	_, err = app.Test(second, -1)
+	assert.NoError(t, err)
+	close(returned)
+	wg.Wait()
+
+	// then
+	txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /users")
+	assert.Equal(t, "GET", txn.AgentAttributes["request.method"])
+	assert.Equal(t, "http://example.com/users", txn.AgentAttributes["request.uri"])
+	assert.Equal(t, "application/json", txn.AgentAttributes["request.headers.accept"])
+}
+
+func TestRecordHTTPVersion(t *testing.T) {
+	for _, minor := range []int{0, 1} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordHTTPVersion: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.ProtoMinor = minor
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+		assert.Equal(t, fmt.Sprintf("HTTP/1.%d", minor), txn.UserAttributes["request.protocol"])
+	}
+}
+
+func TestRecordMethod(t *testing.T) {
+	for _, record := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordMethod: record}))
+		app.Post("/orders", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusCreated)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodPost, "/orders", nil), -1)
+		assert.NoError(t, err)
+
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "POST /orders")
+		if record {
+			assert.Equal(t, http.MethodPost, txn.UserAttributes["request.method"])
+		} else {
+			assert.NotContains(t, txn.UserAttributes, "request.method")
+		}
+	}
+}
+
+func TestRecordPort(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		port float64
+	}{
+		{name: "explicit port", host: "example.com:8080", port: 8080},
+		{name: "implicit port", host: "example.com", port: 80},
+		{name: "IPv6 with port", host: "[::1]:3000", port: 3000},
+		{name: "IPv6 without port", host: "[::1]", port: 80},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, RecordPort: true}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			_, err := app.Test(req, -1)
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, tt.port, txn.UserAttributes["server.port"])
+		})
+	}
+}
+
+func TestRequestInfoPort(t *testing.T) {
+	assert.Equal(t, 443, requestInfo{host: "example.com", scheme: "https"}.port())
+	assert.Equal(t, 8443, requestInfo{host: "example.com:8443", scheme: "https"}.port())
+	assert.Equal(t, 80, requestInfo{host: "example.com:http", scheme: "http"}.port())
+}
+
+func TestRecordXForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted []string
+		header  string
+		ip      interface{}
+	}{
+		{name: "single hop", header: "203.0.113.7", ip: "203.0.113.7"},
+		{name: "skips trusted proxies", trusted: []string{"10.0.0.0/8", "192.0.2.1"}, header: "203.0.113.7, 10.1.2.3, 192.0.2.1", ip: "203.0.113.7"},
+		{name: "ignores spoofed hops before the client", trusted: []string{"10.0.0.0/8"}, header: "198.51.100.1, 203.0.113.7, 10.1.2.3", ip: "203.0.113.7"},
+		{name: "uses the last hop without trusted proxies", header: "203.0.113.7, 10.1.2.3", ip: "10.1.2.3"},
+		{name: "uses the first hop when all are trusted", trusted: []string{"10.0.0.0/8"}, header: "10.0.0.1, 10.0.0.2", ip: "10.0.0.1"},
+		{name: "supports IPv6", trusted: []string{"2001:db8::/32"}, header: "2001:db9::1, 2001:db8::1", ip: "2001:db9::1"},
+		{name: "no header", header: "", ip: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, RecordXForwardedFor: true, TrustedProxies: tt.trusted}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderXForwardedFor, tt.header)
+			}
+			_, err := app.Test(req, -1)
+			assert.NoError(t, err)
+
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, tt.ip, txn.UserAttributes["request.xForwardedFor"])
+		})
+	}
+
+	t.Run("should reject invalid trusted proxies", func(t *testing.T) {
+		nrApp, _ := newTestApplication(t)
+
+		_, err := NewE(Config{Application: nrApp, TrustedProxies: []string{"not-an-ip"}})
+		assert.Error(t, err)
+
+		_, err = NewE(Config{Application: nrApp, TrustedProxies: []string{"10.0.0.0/33"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestRecordAcceptHeader(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordAcceptHeader: true}))
+	app.Get("/:kind", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	withAccept := httptest.NewRequest(http.MethodGet, "/json", nil)
+	withAccept.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+
+	// when
+	for _, req := range []*http.Request{withAccept, httptest.NewRequest(http.MethodGet, "/none", nil)} {
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, fiber.MIMEApplicationJSON, findTransaction(t, txns, "GET /json").UserAttributes["request.accept"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /none").UserAttributes, "request.accept")
+}
+
+func TestRecordReferer(t *testing.T) {
+	const referer = "https://example.com/search?q=secret#results"
+
+	tests := []struct {
+		name     string
+		cfg      Config
+		referer  string
+		expected interface{}
+	}{
+		{name: "should strip the query and fragment", cfg: Config{RecordReferer: true}, referer: referer, expected: "https://example.com/search"},
+		{name: "should keep the query when included", cfg: Config{RecordReferer: true, RefererIncludeQuery: true}, referer: referer, expected: "https://example.com/search?q=secret"},
+		{name: "should not record a missing referer", cfg: Config{RecordReferer: true}, referer: "", expected: nil},
+		{name: "should not record the referer when disabled", cfg: Config{}, referer: referer, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			tt.cfg.Application = nrApp
+			app := fiber.New()
+			app.Use(New(tt.cfg))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.referer != "" {
+				req.Header.Set(fiber.HeaderReferer, tt.referer)
+			}
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+			txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+			assert.Equal(t, tt.expected, txn.UserAttributes["request.referer"])
+		})
+	}
+}
+
+func TestRecordMatchedHost(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordMatchedHost: true}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	hosts := []string{"api.example.com", "admin.example.com"}
+
+	// when
+	for _, host := range hosts {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	var recorded []interface{}
+	for _, txn := range collector.transactionEvents(t, nrApp) {
+		recorded = append(recorded, txn.UserAttributes["request.host"])
+	}
+	assert.ElementsMatch(t, []interface{}{"api.example.com", "admin.example.com"}, recorded)
+}
+
+func TestRecordOrigin(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordOrigin: true}))
+	app.Get("/:kind", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	crossOrigin := httptest.NewRequest(http.MethodGet, "/cross", nil)
+	crossOrigin.Header.Set(fiber.HeaderOrigin, "https://app.example.com")
+
+	// when
+	for _, req := range []*http.Request{crossOrigin, httptest.NewRequest(http.MethodGet, "/same", nil)} {
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, "https://app.example.com", findTransaction(t, txns, "GET /cross").UserAttributes["request.origin"])
+	assert.NotContains(t, findTransaction(t, txns, "GET /same").UserAttributes, "request.origin")
+}
+
+func TestRecordForwardedProto(t *testing.T) {
+	for _, proto := range []string{"http", "https", ""} {
+		// given
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordForwardedProto: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if proto != "" {
+			req.Header.Set(fiber.HeaderXForwardedProto, proto)
+		}
+
+		// when
+		_, err := app.Test(req, -1)
+
+		// then
+		assert.NoError(t, err)
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+		if proto == "" {
+			assert.NotContains(t, txn.UserAttributes, "request.forwardedProto")
+		} else {
+			assert.Equal(t, proto, txn.UserAttributes["request.forwardedProto"])
+		}
+	}
+}
+
+func TestRecordETagHeader(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordETagHeader: true}))
+	app.Get("/:kind", func(ctx *fiber.Ctx) error {
+		ctx.Set(fiber.HeaderETag, `"v1"`)
+		if ctx.Get(fiber.HeaderIfNoneMatch) == `"v1"` {
+			return ctx.SendStatus(http.StatusNotModified)
+		}
+		return ctx.SendString("resource")
+	})
+
+	conditional := httptest.NewRequest(http.MethodGet, "/conditional", nil)
+	conditional.Header.Set(fiber.HeaderIfNoneMatch, `"v1"`)
+	stale := httptest.NewRequest(http.MethodGet, "/stale", nil)
+	stale.Header.Set(fiber.HeaderIfNoneMatch, `"v0"`)
+
+	// when
+	for _, req := range []*http.Request{conditional, stale, httptest.NewRequest(http.MethodGet, "/plain", nil)} {
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+
+	attrs := findTransaction(t, txns, "GET /conditional").UserAttributes
+	assert.Equal(t, `"v1"`, attrs["response.etag"])
+	assert.Equal(t, `"v1"`, attrs["request.ifNoneMatch"])
+	assert.Equal(t, true, attrs["response.notModified"])
+
+	attrs = findTransaction(t, txns, "GET /stale").UserAttributes
+	assert.Equal(t, `"v1"`, attrs["response.etag"])
+	assert.Equal(t, `"v0"`, attrs["request.ifNoneMatch"])
+	assert.NotContains(t, attrs, "response.notModified")
+
+	attrs = findTransaction(t, txns, "GET /plain").UserAttributes
+	assert.Equal(t, `"v1"`, attrs["response.etag"])
+	assert.NotContains(t, attrs, "request.ifNoneMatch")
+	assert.NotContains(t, attrs, "response.notModified")
+}
+
+func TestStripReferer(t *testing.T) {
+	for _, tt := range []struct {
+		referer      string
+		includeQuery bool
+		expected     string
+	}{
+		{referer: "https://example.com/a?b=c#d", expected: "https://example.com/a"},
+		{referer: "https://example.com/a?b=c#d", includeQuery: true, expected: "https://example.com/a?b=c"},
+		{referer: "https://example.com/a#d?b=c", includeQuery: true, expected: "https://example.com/a"},
+		{referer: "/relative?b=c", expected: "/relative"},
+		{referer: "?b=c", expected: ""},
+	} {
+		assert.Equal(t, tt.expected, stripReferer(tt.referer, tt.includeQuery), tt.referer)
+	}
+}
+
+func TestRecordContentNegotiation(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		match  bool
+	}{
+		{name: "matching", accept: "text/html, application/json;q=0.9", match: true},
+		{name: "non-matching", accept: "text/html", match: false},
+		{name: "wildcard", accept: "text/html, */*;q=0.1", match: true},
+		{name: "type wildcard", accept: "application/*", match: true},
+		{name: "not acceptable", accept: "application/json;q=0", match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, RecordContentNegotiation: true}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.JSON(fiber.Map{"ok": true})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderAccept, tt.accept)
+			_, err := app.Test(req, -1)
+			assert.NoError(t, err)
+
+			attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+			assert.Equal(t, tt.accept, attrs["negotiation.accepted"])
+			assert.Equal(t, fiber.MIMEApplicationJSON, attrs["negotiation.contentType"])
+			assert.Equal(t, tt.match, attrs["negotiation.match"])
+		})
+	}
+}
+
+func TestAcceptsMediaType(t *testing.T) {
+	assert.True(t, acceptsMediaType("", "text/plain"))
+	assert.True(t, acceptsMediaType("TEXT/Plain", "text/plain; charset=utf-8"))
+	assert.False(t, acceptsMediaType("text/plain", ""))
+	assert.False(t, acceptsMediaType("text/*;q=0, */*;q=0", "text/plain"))
+}
+
+func TestRecordCookieNames(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordCookieNames: true}))
+	app.Get("/:kind", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	withCookies := httptest.NewRequest(http.MethodGet, "/cookies", nil)
+	withCookies.AddCookie(&http.Cookie{Name: "session", Value: "s3cr3t-token"})
+	withCookies.AddCookie(&http.Cookie{Name: "ab_checkout_v2", Value: "variant-b"})
+
+	// when
+	for _, req := range []*http.Request{withCookies, httptest.NewRequest(http.MethodGet, "/none", nil)} {
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	attrs := findTransaction(t, txns, "GET /cookies").UserAttributes
+	assert.Equal(t, "session,ab_checkout_v2", attrs["request.cookieNames"])
+	for _, value := range attrs {
+		assert.NotContains(t, value, "s3cr3t-token")
+		assert.NotContains(t, value, "variant-b")
+	}
+	assert.NotContains(t, findTransaction(t, txns, "GET /none").UserAttributes, "request.cookieNames")
+}
+
+func TestRecordQueryParamCount(t *testing.T) {
+	for url, count := range map[string]float64{
+		"/search":                      0,
+		"/search?q=shoes":              1,
+		"/search?q=shoes&page=2&size=": 3,
+	} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordQueryParamCount: true}))
+		app.Get("/search", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+
+		attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /search").UserAttributes
+		assert.Equal(t, count, attrs["request.queryParamCount"], url)
+		for _, value := range attrs {
+			assert.NotEqual(t, "shoes", value)
+		}
+	}
+}
+
+func TestRecordQueryString(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected interface{}
+	}{
+		{name: "should record the raw query string", cfg: Config{RecordQueryString: true}, expected: "q=red%20shoes&page=2&size="},
+		{name: "should truncate the query string", cfg: Config{RecordQueryString: true, MaxAttributeValueLength: 6}, expected: "q=red%..."},
+		{name: "should not record the query string when disabled", cfg: Config{}, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			cfg := tt.cfg
+			cfg.Application = nrApp
+			app := fiber.New()
+			app.Use(New(cfg))
+			app.Get("/search", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			// when
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/search?q=red%20shoes&page=2&size=", nil), -1)
+
+			// then
+			assert.NoError(t, err)
+
+			attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /search").UserAttributes
+			assert.Equal(t, tt.expected, attrs["request.queryString"])
+		})
+	}
+}
+
+func TestRecordPathDepth(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordPathDepth: true}))
+	app.Get("/*", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	for _, url := range []string{"/", "/a", "/a/b/c"} {
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+		assert.NoError(t, err)
+	}
+
+	// then
+	txns := collector.transactionEvents(t, nrApp)
+	assert.Equal(t, float64(0), findTransaction(t, txns, "GET /").UserAttributes["request.pathDepth"])
+	assert.Equal(t, float64(1), findTransaction(t, txns, "GET /a").UserAttributes["request.pathDepth"])
+	assert.Equal(t, float64(3), findTransaction(t, txns, "GET /a/b/c").UserAttributes["request.pathDepth"])
+}
+
+func TestPathDepth(t *testing.T) {
+	for path, depth := range map[string]int{
+		"":         0,
+		"/":        0,
+		"/a":       1,
+		"/a/":      1,
+		"/a/b/c":   3,
+		"/a//b/c/": 3,
+	} {
+		assert.Equal(t, depth, pathDepth(path), path)
+	}
+}
+
+func TestRecordRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		denyList []string
+		recorded []string
+		denied   []string
+	}{
+		{
+			name:     "should skip the default deny list",
+			denyList: nil,
+			recorded: []string{"x-tenant", "user-agent"},
+			denied:   []string{"authorization", "cookie", "x-api-key"},
+		},
+		{
+			name:     "should skip the configured deny list",
+			denyList: []string{"x-TENANT"},
+			recorded: []string{"user-agent", "authorization", "cookie", "x-api-key"},
+			denied:   []string{"x-tenant"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{Application: nrApp, RecordRequestHeaders: true, HeaderDenyList: tt.denyList, MaxAttributeValueLength: 8}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Tenant", "acme")
+			req.Header.Set(fiber.HeaderUserAgent, "curl/8.4.0 (x86_64)")
+			req.Header.Set(fiber.HeaderAuthorization, "Bearer token")
+			req.Header.Set(fiber.HeaderCookie, "session=secret")
+			req.Header.Set("X-Api-Key", "secret")
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+			for _, name := range tt.recorded {
+				assert.Contains(t, attrs, "request.header."+name)
+			}
+			for _, name := range tt.denied {
+				assert.NotContains(t, attrs, "request.header."+name)
+			}
+			assert.Equal(t, "curl/8.4...", attrs["request.header.user-agent"])
+		})
+	}
+}
+
+func TestHeaderAllowlistDenylist(t *testing.T) {
+	tests := []struct {
+		name     string
+		allow    []string
+		deny     []string
+		recorded []string
+		denied   []string
+	}{
+		{
+			name:     "should record every header without allowlist and denylist",
+			recorded: []string{"request.header.x-tenant", "request.header.x-region", "request.origin", "response.etag"},
+		},
+		{
+			name:     "should only record the allowlist",
+			allow:    []string{"x-TENANT", "ETag"},
+			recorded: []string{"request.header.x-tenant", "response.etag"},
+			denied:   []string{"request.header.x-region", "request.origin"},
+		},
+		{
+			name:     "should skip the denylist",
+			deny:     []string{"x-REGION", "ETag"},
+			recorded: []string{"request.header.x-tenant", "request.origin"},
+			denied:   []string{"request.header.x-region", "response.etag"},
+		},
+		{
+			name:     "should let the denylist take precedence over the allowlist",
+			allow:    []string{"X-Tenant", "X-Region", "Origin"},
+			deny:     []string{"X-Region"},
+			recorded: []string{"request.header.x-tenant", "request.origin"},
+			denied:   []string{"request.header.x-region", "response.etag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			nrApp, collector := newTestApplication(t)
+			app := fiber.New()
+			app.Use(New(Config{
+				Application:          nrApp,
+				RecordRequestHeaders: true,
+				RecordOrigin:         true,
+				RecordETagHeader:     true,
+				AllowlistHeaders:     tt.allow,
+				DenylistHeaders:      tt.deny,
+			}))
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				ctx.Set(fiber.HeaderETag, `"v1"`)
+				return ctx.SendStatus(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Tenant", "acme")
+			req.Header.Set("X-Region", "eu")
+			req.Header.Set(fiber.HeaderOrigin, "https://example.com")
+
+			// when
+			_, err := app.Test(req, -1)
+
+			// then
+			assert.NoError(t, err)
+
+			attrs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes
+			for _, name := range tt.recorded {
+				assert.Contains(t, attrs, name)
+			}
+			for _, name := range tt.denied {
+				assert.NotContains(t, attrs, name)
+			}
+		})
+	}
+}
+
+func TestRecordPathParameters(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RecordPathParameters: true, PathParameterDenyList: []string{"SSN"}}))
+	app.Get("/users/:id/ssn/:ssn", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/users/42/ssn/078-05-1120", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+
+	attrs := collector.transactionEvents(t, nrApp)[0].UserAttributes
+	assert.Equal(t, "42", attrs["request.parameters.id"])
+	assert.Equal(t, "<redacted>", attrs["request.parameters.ssn"])
+}
@@ -0,0 +1,127 @@
+package fibernewrelic
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// fiberVersionEventType is the custom event type recorded when
+// Config.FiberVersionAsEvent is enabled.
+const fiberVersionEventType = "FiberVersion"
+
+// cpuCount does not change during the process lifetime, so it is read once.
+var cpuCount = runtime.NumCPU()
+
+func recordGoroutineCount(txn *newrelic.Transaction, cfg *Config) {
+	addAttribute(txn, cfg, "runtime.goroutines", runtime.NumGoroutine())
+	addAttribute(txn, cfg, "runtime.cpuCount", cpuCount)
+}
+
+type memStatsSample struct {
+	sampledAt    time.Time
+	alloc        uint64
+	heapSys      uint64
+	numGC        uint32
+	pauseTotalNs uint64
+}
+
+// memStatsSampler caches the last runtime.MemStats snapshot, so that the stop
+// the world runtime.ReadMemStats call happens at most once per interval.
+type memStatsSampler struct {
+	interval time.Duration
+	last     atomic.Value // *memStatsSample
+}
+
+func newMemStatsSampler(interval time.Duration) *memStatsSampler {
+	return &memStatsSampler{interval: interval}
+}
+
+func (s *memStatsSampler) sample() *memStatsSample {
+	if last, ok := s.last.Load().(*memStatsSample); ok && time.Since(last.sampledAt) < s.interval {
+		return last
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	sample := &memStatsSample{
+		sampledAt:    time.Now(),
+		alloc:        stats.Alloc,
+		heapSys:      stats.HeapSys,
+		numGC:        stats.NumGC,
+		pauseTotalNs: stats.PauseTotalNs,
+	}
+	s.last.Store(sample)
+
+	return sample
+}
+
+func recordMemStats(txn *newrelic.Transaction, cfg *Config, sampler *memStatsSampler) {
+	sample := sampler.sample()
+
+	addAttribute(txn, cfg, "mem.alloc", sample.alloc)
+	addAttribute(txn, cfg, "mem.heapSys", sample.heapSys)
+	addAttribute(txn, cfg, "mem.numGC", sample.numGC)
+	addAttribute(txn, cfg, "mem.pauseTotalNs", sample.pauseTotalNs)
+}
+
+type serverLoadSample struct {
+	sampledAt     time.Time
+	maxProcs      int
+	numGoroutines int
+}
+
+// serverLoadSampler caches the last server load sample for an interval, like
+// memStatsSampler.
+type serverLoadSampler struct {
+	interval time.Duration
+	last     atomic.Value // *serverLoadSample
+}
+
+func newServerLoadSampler(interval time.Duration) *serverLoadSampler {
+	return &serverLoadSampler{interval: interval}
+}
+
+func (s *serverLoadSampler) sample() *serverLoadSample {
+	if last, ok := s.last.Load().(*serverLoadSample); ok && time.Since(last.sampledAt) < s.interval {
+		return last
+	}
+
+	sample := &serverLoadSample{
+		sampledAt:     time.Now(),
+		maxProcs:      runtime.GOMAXPROCS(0),
+		numGoroutines: runtime.NumGoroutine(),
+	}
+	s.last.Store(sample)
+
+	return sample
+}
+
+func recordServerLoad(txn *newrelic.Transaction, cfg *Config, sampler *serverLoadSampler) {
+	sample := sampler.sample()
+
+	addAttribute(txn, cfg, "server.numCPU", cpuCount)
+	addAttribute(txn, cfg, "server.maxProcs", sample.maxProcs)
+	addAttribute(txn, cfg, "server.numGoroutines", sample.numGoroutines)
+}
+
+// recordFiberVersion records the Fiber version either on every transaction,
+// or as a single custom event. The event is recorded with the first
+// transaction, as the application may not be connected yet when New is called.
+func recordFiberVersion(txn *newrelic.Transaction, cfg *Config, once *sync.Once) {
+	if !cfg.FiberVersionAsEvent {
+		addAttribute(txn, cfg, "fiber.version", fiber.Version)
+		return
+	}
+
+	once.Do(func() {
+		txn.Application().RecordCustomEvent(fiberVersionEventType, map[string]interface{}{
+			"version": fiber.Version,
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordGoroutineCount(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordGoroutineCount: enabled}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		txns := collector.transactionEvents(t, nrApp)
+		if !assert.Len(t, txns, 1) {
+			continue
+		}
+
+		attrs := txns[0].UserAttributes
+		if !enabled {
+			assert.NotContains(t, attrs, "runtime.goroutines")
+			assert.NotContains(t, attrs, "runtime.cpuCount")
+			continue
+		}
+
+		if assert.IsType(t, float64(0), attrs["runtime.goroutines"]) {
+			assert.Greater(t, attrs["runtime.goroutines"].(float64), float64(0))
+		}
+		if assert.IsType(t, float64(0), attrs["runtime.cpuCount"]) {
+			assert.Greater(t, attrs["runtime.cpuCount"].(float64), float64(0))
+		}
+	}
+}
+
+func TestRecordMemStats(t *testing.T) {
+	t.Run("should record mem stats attributes", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordMemStats: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		txns := collector.transactionEvents(t, nrApp)
+		if assert.Len(t, txns, 1) {
+			for _, key := range []string{"mem.alloc", "mem.heapSys", "mem.numGC", "mem.pauseTotalNs"} {
+				assert.IsType(t, float64(0), txns[0].UserAttributes[key], key)
+			}
+			assert.Greater(t, txns[0].UserAttributes["mem.alloc"], float64(0))
+		}
+	})
+
+	t.Run("should reuse the snapshot within the interval", func(t *testing.T) {
+		sampler := newMemStatsSampler(time.Hour)
+		assert.Same(t, sampler.sample(), sampler.sample())
+	})
+
+	t.Run("should take a new snapshot once the interval elapsed", func(t *testing.T) {
+		sampler := newMemStatsSampler(0)
+		assert.NotSame(t, sampler.sample(), sampler.sample())
+	})
+}
+
+func TestRecordServerLoad(t *testing.T) {
+	t.Run("should record server load attributes", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordServerLoad: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+		for _, key := range []string{"server.numCPU", "server.maxProcs", "server.numGoroutines"} {
+			if assert.IsType(t, float64(0), txn.UserAttributes[key], key) {
+				value := txn.UserAttributes[key].(float64)
+				assert.Greater(t, value, float64(0), key)
+				assert.Equal(t, float64(int64(value)), value, key)
+			}
+		}
+	})
+
+	t.Run("should reuse the sample within the interval", func(t *testing.T) {
+		sampler := newServerLoadSampler(time.Hour)
+		assert.Same(t, sampler.sample(), sampler.sample())
+	})
+
+	t.Run("should take a new sample once the interval elapsed", func(t *testing.T) {
+		sampler := newServerLoadSampler(0)
+		assert.NotSame(t, sampler.sample(), sampler.sample())
+	})
+}
+
+func TestFiberVersionAttribute(t *testing.T) {
+	t.Run("should record the version on every transaction", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, FiberVersionAttribute: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		for i := 0; i < 2; i++ {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+		}
+
+		txns := collector.transactionEvents(t, nrApp)
+		if assert.Len(t, txns, 2) {
+			for _, txn := range txns {
+				assert.Equal(t, fiber.Version, txn.UserAttributes["fiber.version"])
+			}
+		}
+		assert.Empty(t, collector.events(t, "custom_event_data"))
+	})
+
+	t.Run("should record the version once as custom event", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, FiberVersionAttribute: true, FiberVersionAsEvent: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		for i := 0; i < 2; i++ {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+		}
+
+		events := collector.customEvents(t, nrApp)
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, fiberVersionEventType, events[0].Intrinsics["type"])
+			assert.Equal(t, fiber.Version, events[0].UserAttributes["version"])
+		}
+		for _, txn := range collector.events(t, "analytic_event_data") {
+			assert.NotContains(t, txn.UserAttributes, "fiber.version")
+		}
+	})
+}
+
+func TestRecordFiberVersion(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, RecordFiberVersion: enabled}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		for i := 0; i < 2; i++ {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+			assert.NoError(t, err)
+		}
+
+		txns := collector.transactionEvents(t, nrApp)
+		assert.Len(t, txns, 2)
+		for _, txn := range txns {
+			if enabled {
+				assert.Equal(t, "fiber", txn.UserAttributes["framework.name"])
+				assert.Equal(t, fiber.Version, txn.UserAttributes["framework.version"])
+			} else {
+				assert.NotContains(t, txn.UserAttributes, "framework.name")
+				assert.NotContains(t, txn.UserAttributes, "framework.version")
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package fibernewrelic
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// ErrUnsupportedSegmentType is returned by AddSegmentAttributes for values
+// which are not New Relic segments.
+var ErrUnsupportedSegmentType = errors.New("fibernewrelic: unsupported segment type")
+
+// StartSegment starts a segment on the transaction of the current request.
+func StartSegment(c *fiber.Ctx, name string) *newrelic.Segment {
+	txn, cfg := segmentTransactionFromContext(c)
+
+	seg := txn.StartSegment(name)
+	if name := formatSegmentName(cfg, seg); name != "" {
+		seg.Name = name
+	}
+
+	return seg
+}
+
+// StartDataStoreSegment starts a datastore segment on the transaction of the
+// current request.
+func StartDataStoreSegment(c *fiber.Ctx, product newrelic.DatastoreProduct, collection, operation string) *newrelic.DatastoreSegment {
+	txn, cfg := segmentTransactionFromContext(c)
+
+	seg := &newrelic.DatastoreSegment{
+		StartTime:  txn.StartSegmentNow(),
+		Product:    product,
+		Collection: collection,
+		Operation:  operation,
+	}
+	if name := formatSegmentName(cfg, seg); name != "" {
+		seg.Operation = name
+	}
+
+	return seg
+}
+
+// StartExternalSegment starts an external segment for the outgoing request on
+// the transaction of the current request. The distributed trace headers, and
+// the request ID with Config.TagAllWithRequestID, are added to the outgoing
+// request. Once Config.MaxSegmentsPerTransaction is reached, a segment which
+// is not recorded is returned, and the headers are still added.
+func StartExternalSegment(c *fiber.Ctx, req *http.Request) *newrelic.ExternalSegment {
+	txn, cfg := segmentTransactionFromContext(c)
+	if req != nil && req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	var seg *newrelic.ExternalSegment
+	if txn == nil && cfg != nil {
+		// The agent would take the transaction from the request context.
+		seg = &newrelic.ExternalSegment{Request: req}
+		if req != nil {
+			getRequestState(c).txn.InsertDistributedTraceHeaders(req.Header)
+		}
+	} else {
+		seg = newrelic.StartExternalSegment(txn, req)
+	}
+	if cfg != nil && req != nil {
+		formatOutboundHeaders(req.Header, cfg.TraceContextPropagation)
+		if id := outboundRequestID(c, cfg); id != "" {
+			req.Header.Set(fiber.HeaderXRequestID, id)
+		}
+	}
+	if name := formatSegmentName(cfg, seg); name != "" {
+		seg.Procedure = name
+	}
+
+	return seg
+}
+
+// StartMessageProducerSegment starts a message producer segment on the
+// transaction of the current request.
+func StartMessageProducerSegment(c *fiber.Ctx, library string, destinationType newrelic.MessageDestinationType, destinationName string) *newrelic.MessageProducerSegment {
+	txn, cfg := segmentTransactionFromContext(c)
+
+	seg := &newrelic.MessageProducerSegment{
+		StartTime:       txn.StartSegmentNow(),
+		Library:         library,
+		DestinationType: destinationType,
+		DestinationName: destinationName,
+	}
+	if name := formatSegmentName(cfg, seg); name != "" {
+		seg.DestinationName = name
+	}
+
+	return seg
+}
+
+// formatSegmentName returns the name produced by Config.SpanNameFormatter, or
+// an empty string to keep the segment name.
+func formatSegmentName(cfg *Config, seg interface{}) string {
+	if cfg == nil || cfg.SpanNameFormatter == nil {
+		return ""
+	}
+
+	return cfg.SpanNameFormatter(seg)
+}
+
+// AddSegmentAttributes adds attrs to a *newrelic.Segment, *newrelic.DatastoreSegment,
+// *newrelic.ExternalSegment or *newrelic.MessageProducerSegment, such as the
+// ones returned by the segment helpers. ErrUnsupportedSegmentType is returned
+// for any other value. The agent adds the attributes to the innermost open
+// segment, so call it before starting a child segment.
+func AddSegmentAttributes(seg interface{}, attrs map[string]interface{}) error {
+	var add func(key string, value interface{})
+
+	switch s := seg.(type) {
+	case *newrelic.Segment:
+		add = s.AddAttribute
+	case *newrelic.DatastoreSegment:
+		add = s.AddAttribute
+	case *newrelic.ExternalSegment:
+		add = s.AddAttribute
+	case *newrelic.MessageProducerSegment:
+		add = s.AddAttribute
+	default:
+		return ErrUnsupportedSegmentType
+	}
+
+	for key, value := range attrs {
+		add(key, value)
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentHelpers(t *testing.T) {
+	handler := func(ctx *fiber.Ctx) error {
+		StartSegment(ctx, "render").End()
+		StartDataStoreSegment(ctx, newrelic.DatastorePostgres, "users", "select").End()
+		StartExternalSegment(ctx, httptest.NewRequest(http.MethodGet, "http://payments.test/charge", nil)).End()
+		StartMessageProducerSegment(ctx, "Kafka", newrelic.MessageTopic, "orders").End()
+		return ctx.SendStatus(http.StatusOK)
+	}
+
+	t.Run("should keep the default segment names", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp}))
+		app.Get("/", handler)
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		metrics := collector.metrics(t, nrApp)
+		assert.Contains(t, metrics, "Custom/render")
+		assert.Contains(t, metrics, "Datastore/statement/Postgres/users/select")
+		assert.Contains(t, metrics, "External/payments.test/http/GET")
+		assert.Contains(t, metrics, "MessageBroker/Kafka/Topic/Produce/Named/orders")
+	})
+
+	t.Run("should apply the span name formatter", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{
+			Application: nrApp,
+			SpanNameFormatter: func(segment interface{}) string {
+				switch s := segment.(type) {
+				case *newrelic.Segment:
+					return "app/" + s.Name
+				case *newrelic.DatastoreSegment:
+					return strings.ToUpper(s.Operation)
+				case *newrelic.ExternalSegment:
+					return "CHARGE"
+				default:
+					return ""
+				}
+			},
+		}))
+		app.Get("/", handler)
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		metrics := collector.metrics(t, nrApp)
+		assert.Contains(t, metrics, "Custom/app/render")
+		assert.Contains(t, metrics, "Datastore/statement/Postgres/users/SELECT")
+		assert.Contains(t, metrics, "External/payments.test/http/CHARGE")
+		assert.Contains(t, metrics, "MessageBroker/Kafka/Topic/Produce/Named/orders")
+	})
+
+	t.Run("should not panic for requests which are not instrumented", func(t *testing.T) {
+		app := fiber.New()
+		app.Get("/", handler)
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestAddSegmentAttributes(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		attrs := map[string]interface{}{"tenant": "acme"}
+
+		seg := StartSegment(ctx, "render")
+		assert.NoError(t, AddSegmentAttributes(seg, attrs))
+		seg.End()
+
+		dsSeg := StartDataStoreSegment(ctx, newrelic.DatastorePostgres, "users", "select")
+		assert.NoError(t, AddSegmentAttributes(dsSeg, attrs))
+		dsSeg.End()
+
+		extSeg := StartExternalSegment(ctx, httptest.NewRequest(http.MethodGet, "http://payments.test/charge", nil))
+		assert.NoError(t, AddSegmentAttributes(extSeg, attrs))
+		extSeg.End()
+
+		msgSeg := StartMessageProducerSegment(ctx, "Kafka", newrelic.MessageTopic, "orders")
+		assert.NoError(t, AddSegmentAttributes(msgSeg, attrs))
+		msgSeg.End()
+
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+	assert.ErrorIs(t, AddSegmentAttributes("render", map[string]interface{}{"tenant": "acme"}), ErrUnsupportedSegmentType)
+	assert.ErrorIs(t, AddSegmentAttributes(newrelic.Segment{}, nil), ErrUnsupportedSegmentType)
+
+	collector.harvest(nrApp)
+	var tagged []interface{}
+	for _, span := range collector.events(t, "span_event_data") {
+		if span.UserAttributes["tenant"] == "acme" {
+			tagged = append(tagged, span.Intrinsics["name"])
+		}
+	}
+	assert.ElementsMatch(t, []interface{}{
+		"Custom/render",
+		"Datastore/statement/Postgres/users/select",
+		"External/payments.test/http/GET",
+		"MessageBroker/Kafka/Topic/Produce/Named/orders",
+	}, tagged)
+}
+
+func TestMaxSegmentsPerTransaction(t *testing.T) {
+	// given
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, MaxSegmentsPerTransaction: 3}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		for _, name := range []string{"query-1", "query-2"} {
+			StartSegment(ctx, name).End()
+		}
+		StartDataStoreSegment(ctx, newrelic.DatastorePostgres, "users", "select").End()
+		StartDataStoreSegment(ctx, newrelic.DatastorePostgres, "orders", "select").End()
+		StartSegment(ctx, "query-3").End()
+
+		req, err := http.NewRequestWithContext(ctx.UserContext(), http.MethodGet, "http://downstream.test/", nil)
+		assert.NoError(t, err)
+		seg := StartExternalSegment(ctx, req)
+		seg.End()
+		assert.NotEmpty(t, req.Header.Get("traceparent"))
+
+		StartExternalSegment(ctx, &http.Request{Method: http.MethodGet, URL: req.URL}).End()
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+	assert.NoError(t, err)
+
+	// then
+	metrics := collector.metrics(t, nrApp)
+	assert.Contains(t, metrics, "Custom/query-1")
+	assert.Contains(t, metrics, "Custom/query-2")
+	assert.Contains(t, metrics, "Datastore/statement/Postgres/users/select")
+	assert.NotContains(t, metrics, "Datastore/statement/Postgres/orders/select")
+	assert.NotContains(t, metrics, "Custom/query-3")
+	assert.NotContains(t, metrics, "External/downstream.test/all")
+
+	txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+	assert.Equal(t, true, txn.UserAttributes["nrMaxSegmentsExceeded"])
+}
+
+func TestRequestTimeoutSegment(t *testing.T) {
+	// given
+	const handlerTime = 20 * time.Millisecond
+
+	nrApp, collector := newTestApplication(t)
+	app := fiber.New()
+	app.Use(New(Config{Application: nrApp, RequestTimeoutSegment: true}))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		time.Sleep(handlerTime)
+		return ctx.SendStatus(http.StatusOK)
+	})
+
+	// when
+	_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+	// then
+	assert.NoError(t, err)
+
+	ttfbMs := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /").UserAttributes["response.ttfbMs"]
+	if assert.IsType(t, float64(0), ttfbMs) {
+		assert.GreaterOrEqual(t, ttfbMs.(float64), float64(handlerTime.Milliseconds()))
+		assert.Less(t, ttfbMs.(float64), float64(handlerTime.Milliseconds()+500))
+	}
+
+	segmentTime := collector.metricTotals(t, nrApp)["Custom/ttfb"]
+	assert.GreaterOrEqual(t, segmentTime, handlerTime.Seconds())
+	assert.Less(t, segmentTime, handlerTime.Seconds()+0.5)
+}
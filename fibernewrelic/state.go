@@ -0,0 +1,146 @@
+package fibernewrelic
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+type contextKey string
+
+// requestStateKey is the fiber.Ctx locals key of the per-request middleware
+// state of the innermost middleware.
+const requestStateKey contextKey = "fibernewrelic.request"
+
+// namespaceStateKey returns the fiber.Ctx locals key of the per-request state
+// of the middleware with the given Config.Namespace.
+func namespaceStateKey(namespace string) contextKey {
+	return requestStateKey + contextKey("."+namespace)
+}
+
+// requestState is stored in the fiber.Ctx locals for every instrumented
+// request, so the package helpers can access the transaction and the config
+// of the middleware which created it.
+type requestState struct {
+	cfg *Config
+	txn *newrelic.Transaction
+	// segments counts the segments started by the package helpers. It is
+	// updated atomically, as segments may be started from other goroutines.
+	segments int64
+	// errors counts the errors noticed by the middleware and NoticeError. It
+	// is updated atomically like segments.
+	errors int64
+	// attributes counts the attributes added by AddTransactionAttribute. It is
+	// updated atomically like segments.
+	attributes int64
+
+	// The final status code, the ignore decision and the noticed errors of the
+	// transaction, reused by the secondary applications of NewMultiApp.
+	statusCode int
+	ignored    bool
+	errorsMu   sync.Mutex
+	noticed    []error
+}
+
+func getRequestState(c *fiber.Ctx) *requestState {
+	if c == nil {
+		return nil
+	}
+
+	state, _ := c.Locals(requestStateKey).(*requestState)
+
+	return state
+}
+
+// transactionFromContext returns the transaction of the current request and
+// the config of the middleware which created it. The config is nil when the
+// transaction was not created by this package.
+func transactionFromContext(c *fiber.Ctx) (*newrelic.Transaction, *Config) {
+	if state := getRequestState(c); state != nil {
+		return state.txn, state.cfg
+	}
+
+	return FromContext(c), nil
+}
+
+// segmentTransaction returns the transaction to start a new segment on. Once
+// Config.MaxSegmentsPerTransaction segments were started, it returns nil, so
+// the segment is a no-op, and marks the transaction as exceeding the limit.
+func (s *requestState) segmentTransaction() *newrelic.Transaction {
+	if s.cfg.MaxSegmentsPerTransaction <= 0 {
+		return s.txn
+	}
+
+	count := atomic.AddInt64(&s.segments, 1)
+	if count <= int64(s.cfg.MaxSegmentsPerTransaction) {
+		return s.txn
+	}
+
+	if count == int64(s.cfg.MaxSegmentsPerTransaction)+1 {
+		addAttribute(s.txn, s.cfg, "nrMaxSegmentsExceeded", true)
+	}
+
+	return nil
+}
+
+// segmentTransactionFromContext is transactionFromContext for starting a new
+// segment, honouring Config.MaxSegmentsPerTransaction.
+func segmentTransactionFromContext(c *fiber.Ctx) (*newrelic.Transaction, *Config) {
+	if state := getRequestState(c); state != nil {
+		return state.segmentTransaction(), state.cfg
+	}
+
+	return FromContext(c), nil
+}
+
+// addAttribute adds an attribute to the transaction until
+// Config.MaxCustomAttributes attributes were added, and marks the transaction
+// as exceeding the limit.
+func (s *requestState) addAttribute(key string, value interface{}) {
+	count := atomic.AddInt64(&s.attributes, 1)
+	if count > int64(s.cfg.MaxCustomAttributes) {
+		if count == int64(s.cfg.MaxCustomAttributes)+1 {
+			addAttribute(s.txn, s.cfg, "nrMaxAttrsExceeded", true)
+		}
+
+		return
+	}
+
+	addAttribute(s.txn, s.cfg, key, value)
+}
+
+// noticeError notices err on the transaction until Config.MaxErrorsPerRequest
+// errors were noticed, and marks the transaction as exceeding the limit.
+func (s *requestState) noticeError(err error) {
+	if s.cfg.MaxErrorsPerRequest > 0 {
+		count := atomic.AddInt64(&s.errors, 1)
+		if count > int64(s.cfg.MaxErrorsPerRequest) {
+			if count == int64(s.cfg.MaxErrorsPerRequest)+1 {
+				addAttribute(s.txn, s.cfg, "nrMaxErrorsExceeded", true)
+			}
+
+			return
+		}
+	}
+
+	err = rewriteErrorMessage(err, s.cfg)
+	if s.cfg.LogTransactionErrors {
+		logTransactionError(s.cfg, s.txn, err)
+	}
+
+	s.errorsMu.Lock()
+	s.noticed = append(s.noticed, err)
+	s.errorsMu.Unlock()
+
+	s.txn.NoticeError(err)
+}
+
+// noticedErrors returns the errors noticed on the transaction.
+func (s *requestState) noticedErrors() []error {
+	s.errorsMu.Lock()
+	defer s.errorsMu.Unlock()
+
+	return append([]error(nil), s.noticed...)
+}
@@ -0,0 +1,206 @@
+package fibernewrelic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// evictedApplicationShutdownTimeout is the time given to an evicted
+// application to flush its pending data.
+const evictedApplicationShutdownTimeout = 5 * time.Second
+
+// applicationCache holds the New Relic applications created for the names
+// returned by Config.NRApplicationName.
+type applicationCache struct {
+	cfg     Config
+	ttl     time.Duration
+	maxSize int
+	apps    sync.Map
+	// mu guards the changes of apps and size.
+	mu   sync.Mutex
+	size int
+}
+
+// cachedApplication is an application of the cache, or the failure to create
+// it when app is nil, so it is not created again on every request. An evicted
+// application is shut down once the last transaction using it ended.
+type cachedApplication struct {
+	app     *newrelic.Application
+	created time.Time
+
+	mu       sync.Mutex
+	inFlight int
+	evicted  bool
+}
+
+func newApplicationCache(cfg Config) *applicationCache {
+	cfg.Application = nil
+
+	return &applicationCache{cfg: cfg, ttl: cfg.ApplicationCacheTTL, maxSize: cfg.ApplicationCacheSize}
+}
+
+// get returns the application for the request, or fallback when no name is
+// returned or the application can not be created. release must be called
+// once the transaction started on the application ended.
+func (ac *applicationCache) get(c *fiber.Ctx, fallback *newrelic.Application) (app *newrelic.Application, release func()) {
+	name := ac.cfg.NRApplicationName(c)
+	if name == "" {
+		return fallback, func() {}
+	}
+
+	if cached, ok := ac.load(name); ok && cached.acquire() {
+		return cached.use(fallback)
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	if cached, ok := ac.load(name); ok && cached.acquire() {
+		return cached.use(fallback)
+	}
+
+	// The name may reference the request buffers, which are reused by Fiber.
+	name = utils.CopyString(name)
+
+	cfg := ac.cfg
+	cfg.AppName = name
+
+	created, err := createApplication(&cfg)
+	if err != nil {
+		log.Errorf("fibernewrelic: using the default New Relic application for %q: %v", name, err)
+	}
+
+	if evicted, ok := ac.apps.Load(name); ok {
+		ac.remove(name, evicted.(*cachedApplication))
+	}
+	ac.sweep()
+	if ac.size >= ac.maxSize {
+		ac.removeOldest()
+	}
+
+	cached := &cachedApplication{app: created, created: time.Now()}
+	ac.apps.Store(name, cached)
+	ac.size++
+	if created != nil && drainEnabled(&ac.cfg) {
+		drainer.register(created, ac.cfg.DrainTimeout)
+	}
+
+	cached.acquire()
+
+	return cached.use(fallback)
+}
+
+func (ac *applicationCache) load(name string) (*cachedApplication, bool) {
+	entry, ok := ac.apps.Load(name)
+	if !ok {
+		return nil, false
+	}
+
+	cached := entry.(*cachedApplication)
+	if ac.ttl > 0 && time.Since(cached.created) >= ac.ttl {
+		return nil, false
+	}
+
+	return cached, true
+}
+
+// sweep removes the expired applications, so the names which are not used
+// again do not keep theirs. ac.mu must be held.
+func (ac *applicationCache) sweep() {
+	if ac.ttl <= 0 {
+		return
+	}
+
+	ac.apps.Range(func(name, entry interface{}) bool {
+		if cached := entry.(*cachedApplication); time.Since(cached.created) >= ac.ttl {
+			ac.remove(name, cached)
+		}
+		return true
+	})
+}
+
+// removeOldest removes the application created first. ac.mu must be held.
+func (ac *applicationCache) removeOldest() {
+	var (
+		oldestName interface{}
+		oldest     *cachedApplication
+	)
+	ac.apps.Range(func(name, entry interface{}) bool {
+		if cached := entry.(*cachedApplication); oldest == nil || cached.created.Before(oldest.created) {
+			oldestName, oldest = name, cached
+		}
+		return true
+	})
+
+	if oldest != nil {
+		ac.remove(oldestName, oldest)
+	}
+}
+
+// remove evicts the application cached for name. ac.mu must be held.
+func (ac *applicationCache) remove(name interface{}, cached *cachedApplication) {
+	ac.apps.Delete(name)
+	ac.size--
+	cached.evict()
+}
+
+// acquire counts a transaction using the application, unless it was evicted.
+func (ca *cachedApplication) acquire() bool {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.evicted {
+		return false
+	}
+	ca.inFlight++
+
+	return true
+}
+
+// use returns the acquired application, or fallback when it could not be
+// created, along with its release function.
+func (ca *cachedApplication) use(fallback *newrelic.Application) (*newrelic.Application, func()) {
+	if ca.app == nil {
+		ca.release()
+		return fallback, func() {}
+	}
+
+	return ca.app, ca.release
+}
+
+func (ca *cachedApplication) release() {
+	ca.mu.Lock()
+	ca.inFlight--
+	shutdown := ca.evicted && ca.inFlight == 0
+	ca.mu.Unlock()
+
+	if shutdown {
+		go ca.shutdown()
+	}
+}
+
+// evict shuts the application down, once the transactions using it ended.
+func (ca *cachedApplication) evict() {
+	ca.mu.Lock()
+	ca.evicted = true
+	shutdown := ca.inFlight == 0
+	ca.mu.Unlock()
+
+	if shutdown {
+		go ca.shutdown()
+	}
+}
+
+func (ca *cachedApplication) shutdown() {
+	if ca.app == nil {
+		return
+	}
+
+	drainer.unregister(ca.app)
+	ca.app.Shutdown(evictedApplicationShutdownTimeout)
+}
@@ -0,0 +1,186 @@
+package fibernewrelic
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNRApplicationName(t *testing.T) {
+	newApp := func(ttl time.Duration, seen map[string][]*newrelic.Application) *fiber.App {
+		app := fiber.New()
+		app.Use(New(Config{
+			License:             testLicense,
+			Enabled:             false,
+			NRApplicationName:   func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+			ApplicationCacheTTL: ttl,
+		}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			tenant := utils.CopyString(ctx.Get("X-Tenant"))
+			seen[tenant] = append(seen[tenant], FromContext(ctx).Application())
+			return ctx.SendStatus(http.StatusOK)
+		})
+		return app
+	}
+
+	send := func(t *testing.T, app *fiber.App, tenant string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		_, err := app.Test(req, -1)
+		assert.NoError(t, err)
+	}
+
+	t.Run("should use one application per name", func(t *testing.T) {
+		seen := map[string][]*newrelic.Application{}
+		app := newApp(0, seen)
+
+		for _, tenant := range []string{"acme", "globex", "acme", ""} {
+			send(t, app, tenant)
+		}
+
+		assert.Equal(t, seen["acme"][0].Private, seen["acme"][1].Private)
+		assert.NotEqual(t, seen["acme"][0].Private, seen["globex"][0].Private)
+		assert.NotEqual(t, seen["acme"][0].Private, seen[""][0].Private)
+		assert.NotEqual(t, seen["globex"][0].Private, seen[""][0].Private)
+	})
+
+	t.Run("should create the application again after the ttl", func(t *testing.T) {
+		seen := map[string][]*newrelic.Application{}
+		app := newApp(10*time.Millisecond, seen)
+
+		send(t, app, "acme")
+		time.Sleep(20 * time.Millisecond)
+		send(t, app, "acme")
+
+		assert.NotEqual(t, seen["acme"][0].Private, seen["acme"][1].Private)
+	})
+	t.Run("should shut the application created first down once the size is reached", func(t *testing.T) {
+		stubSignals(t)
+		seen := map[string][]*newrelic.Application{}
+		tenants := newApplicationCache(Config{
+			License:              testLicense,
+			NRApplicationName:    func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+			ApplicationCacheSize: 2,
+			DrainTimeout:         time.Second,
+		})
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			got, release := tenants.get(c, nil)
+			release()
+			tenant := utils.CopyString(c.Get("X-Tenant"))
+			seen[tenant] = append(seen[tenant], got)
+			return c.SendStatus(http.StatusOK)
+		})
+
+		for _, tenant := range []string{"acme", "globex", "initech"} {
+			send(t, app, tenant)
+		}
+
+		assert.Equal(t, 2, tenants.size)
+		_, ok := tenants.load("acme")
+		assert.False(t, ok)
+		assert.Eventually(t, func() bool {
+			_, ok := registeredApps()[seen["acme"][0]]
+			return !ok
+		}, time.Second, time.Millisecond)
+		assert.Contains(t, registeredApps(), seen["initech"][0])
+	})
+
+	t.Run("should shut the expired applications down when another one is created", func(t *testing.T) {
+		tenants := newApplicationCache(Config{
+			License:              testLicense,
+			NRApplicationName:    func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+			ApplicationCacheTTL:  10 * time.Millisecond,
+			ApplicationCacheSize: 10,
+		})
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			_, release := tenants.get(c, nil)
+			release()
+			return c.SendStatus(http.StatusOK)
+		})
+
+		send(t, app, "acme")
+		time.Sleep(20 * time.Millisecond)
+		send(t, app, "globex")
+
+		_, ok := tenants.apps.Load("acme")
+		assert.False(t, ok)
+		assert.Equal(t, 1, tenants.size)
+	})
+
+	t.Run("should fail without a license", func(t *testing.T) {
+		nrApp, _ := newTestApplication(t)
+		_, err := NewE(Config{
+			Application:       nrApp,
+			NRApplicationName: func(c *fiber.Ctx) string { return c.Get("X-Tenant") },
+		})
+
+		assert.EqualError(t, err, "unable to create New Relic Application -> NRApplicationName requires License")
+	})
+
+	t.Run("should report to the default application when the application can not be created", func(t *testing.T) {
+		tenants := newApplicationCache(Config{
+			License:           "invalid",
+			Enabled:           true,
+			NRApplicationName: func(c *fiber.Ctx) string { return "acme" },
+		})
+		fallback, err := newrelic.NewApplication(newrelic.ConfigEnabled(false))
+		assert.NoError(t, err)
+
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			for i := 0; i < 2; i++ {
+				got, release := tenants.get(c, fallback)
+				release()
+				assert.Equal(t, fallback, got)
+			}
+			return c.SendStatus(http.StatusOK)
+		})
+		_, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		cached, ok := tenants.load("acme")
+		assert.True(t, ok)
+		assert.Nil(t, cached.app)
+	})
+
+	t.Run("should shut an evicted application down once its transactions ended", func(t *testing.T) {
+		stubSignals(t)
+		nrApp, err := newrelic.NewApplication(newrelic.ConfigEnabled(false))
+		assert.NoError(t, err)
+		drainer.register(nrApp, time.Second)
+		cached := &cachedApplication{app: nrApp, created: time.Now()}
+
+		assert.True(t, cached.acquire())
+		cached.evict()
+		assert.False(t, cached.acquire())
+		time.Sleep(10 * time.Millisecond)
+		assert.Contains(t, registeredApps(), nrApp)
+
+		cached.release()
+		assert.Eventually(t, func() bool {
+			_, ok := registeredApps()[nrApp]
+			return !ok
+		}, time.Second, time.Millisecond)
+	})
+}
+
+func registeredApps() map[*newrelic.Application]time.Duration {
+	drainer.mu.Lock()
+	defer drainer.mu.Unlock()
+
+	apps := make(map[*newrelic.Application]time.Duration, len(drainer.apps))
+	for app, timeout := range drainer.apps {
+		apps[app] = timeout
+	}
+	return apps
+}
@@ -0,0 +1,38 @@
+package fibernewrelic
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+// recordTLSInfo records the TLS version and cipher suite of the connection,
+// or tls.version "none" for plain connections.
+func recordTLSInfo(c *fiber.Ctx, txn *newrelic.Transaction, cfg *Config) {
+	state := c.Context().TLSConnectionState()
+	if !c.Context().IsTLS() || state == nil {
+		addAttribute(txn, cfg, "tls.version", "none")
+		return
+	}
+
+	addAttribute(txn, cfg, "tls.version", tlsVersionName(state.Version))
+	addAttribute(txn, cfg, "tls.cipherSuite", tls.CipherSuiteName(state.CipherSuite))
+}
+
+// tlsVersionName mirrors tls.VersionName, which requires Go 1.21.
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04X", version)
+	}
+}
@@ -0,0 +1,127 @@
+package fibernewrelic
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenTLS serves app over TLS 1.3 until the test ends. It returns a client
+// trusting the server certificate and the base URL of the server.
+func listenTLS(t *testing.T, app *fiber.App) (*http.Client, string) {
+	t.Helper()
+
+	// borrow the certificate and trusting client of a httptest TLS server
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	client := srv.Client()
+	certificates := srv.TLS.Certificates
+	srv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: certificates,
+		MinVersion:   tls.VersionTLS13,
+	})
+	require.NoError(t, err)
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	return client, "https://" + ln.Addr().String()
+}
+
+func TestRecordTLSInfo(t *testing.T) {
+	newApp := func(t *testing.T) (*fiber.App, *testCollector, func()) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New(fiber.Config{DisableStartupMessage: true})
+		app.Use(New(Config{Application: nrApp, RecordTLSInfo: true}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		return app, collector, func() { collector.harvest(nrApp) }
+	}
+
+	t.Run("should record the TLS connection state", func(t *testing.T) {
+		// given
+		app, collector, harvest := newApp(t)
+
+		client, baseURL := listenTLS(t, app)
+
+		// when
+		resp, err := client.Get(baseURL + "/")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NoError(t, resp.Body.Close())
+
+		harvest()
+		txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+		assert.Equal(t, "TLS 1.3", txn.UserAttributes["tls.version"])
+		assert.Equal(t, tls.CipherSuiteName(resp.TLS.CipherSuite), txn.UserAttributes["tls.cipherSuite"])
+	})
+
+	t.Run("should record plain connections", func(t *testing.T) {
+		app, collector, harvest := newApp(t)
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		harvest()
+		txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+		assert.Equal(t, "none", txn.UserAttributes["tls.version"])
+		assert.NotContains(t, txn.UserAttributes, "tls.cipherSuite")
+	})
+}
+
+func TestRecordScheme(t *testing.T) {
+	newApp := func(t *testing.T, record bool) (*fiber.App, *testCollector, func()) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New(fiber.Config{DisableStartupMessage: true})
+		app.Use(New(Config{Application: nrApp, RecordScheme: record}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		return app, collector, func() { collector.harvest(nrApp) }
+	}
+
+	t.Run("should record https for TLS requests", func(t *testing.T) {
+		app, collector, harvest := newApp(t, true)
+		client, baseURL := listenTLS(t, app)
+
+		resp, err := client.Get(baseURL + "/")
+		require.NoError(t, err)
+		assert.NoError(t, resp.Body.Close())
+
+		harvest()
+		txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+		assert.Equal(t, "https", txn.UserAttributes["request.scheme"])
+	})
+
+	t.Run("should record http for plain requests", func(t *testing.T) {
+		app, collector, harvest := newApp(t, true)
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		harvest()
+		txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+		assert.Equal(t, "http", txn.UserAttributes["request.scheme"])
+	})
+
+	t.Run("should not record the scheme by default", func(t *testing.T) {
+		app, collector, harvest := newApp(t, false)
+
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+
+		harvest()
+		txn := findTransaction(t, collector.events(t, "analytic_event_data"), "GET /")
+		assert.NotContains(t, txn.UserAttributes, "request.scheme")
+	})
+}
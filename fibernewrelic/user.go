@@ -0,0 +1,44 @@
+package fibernewrelic
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWTSubExtractor returns a UserIDExtractor reading the `sub` claim of the JWT
+// sent in the given header. An optional "Bearer " prefix is ignored. The token
+// signature is NOT validated, so the value must only be used for reporting.
+func JWTSubExtractor(headerName string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		token := c.Get(headerName)
+		if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+			token = token[7:]
+		}
+
+		return jwtSubject(strings.TrimSpace(token))
+	}
+}
+
+func jwtSubject(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+
+	return claims.Sub
+}
@@ -0,0 +1,72 @@
+package fibernewrelic
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func testJWT(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		enc.EncodeToString([]byte(payload)) + ".signature"
+}
+
+func TestJWTSubject(t *testing.T) {
+	assert.Equal(t, "user-1", jwtSubject(testJWT(`{"sub":"user-1","name":"John"}`)))
+	assert.Equal(t, "", jwtSubject(testJWT(`{"name":"John"}`)))
+	assert.Equal(t, "", jwtSubject(testJWT(`not json`)))
+	assert.Equal(t, "", jwtSubject("not-a-jwt"))
+	assert.Equal(t, "", jwtSubject(""))
+}
+
+func TestUserIDExtractor(t *testing.T) {
+	t.Run("should record the user ID from a JWT", func(t *testing.T) {
+		// given
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, UserIDExtractor: JWTSubExtractor(fiber.HeaderAuthorization)}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		// when
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+testJWT(`{"sub":"user-1"}`))
+		_, err := app.Test(req, -1)
+
+		// then
+		assert.NoError(t, err)
+		txn := findTransaction(t, collector.transactionEvents(t, nrApp), "GET /")
+		assert.Equal(t, "user-1", txn.AgentAttributes["enduser.id"])
+	})
+
+	t.Run("should call the extractor after the next handlers", func(t *testing.T) {
+		nrApp, collector := newTestApplication(t)
+		app := fiber.New()
+		app.Use(New(Config{Application: nrApp, UserIDExtractor: func(c *fiber.Ctx) string {
+			userID, _ := c.Locals("user").(string)
+			return userID
+		}}))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			ctx.Locals("user", "user-2")
+			return ctx.SendStatus(http.StatusOK)
+		})
+		app.Get("/anonymous", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(http.StatusOK)
+		})
+
+		for _, url := range []string{"/", "/anonymous"} {
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil), -1)
+			assert.NoError(t, err)
+		}
+
+		events := collector.transactionEvents(t, nrApp)
+		assert.Equal(t, "user-2", findTransaction(t, events, "GET /").AgentAttributes["enduser.id"])
+		assert.NotContains(t, findTransaction(t, events, "GET /anonymous").AgentAttributes, "enduser.id")
+	})
+}
@@ -0,0 +1,45 @@
+package fibernewrelic
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// viewsStateKey is the view bind key the middleware passes the per-request
+// state to NRViewsEngine with, as fiber.Views are not given the fiber.Ctx.
+const viewsStateKey = "fibernewrelic.request"
+
+// viewsEngine decorates a fiber.Views with a segment around every render.
+type viewsEngine struct {
+	fiber.Views
+}
+
+// NRViewsEngine decorates inner with a "render/<template>" segment around
+// every Render of a request instrumented with Config.AutoInstrumentTemplates.
+// Use it as fiber.Config.Views. Only renders with a fiber.Map or nil bind are
+// instrumented. inner is returned unchanged when cfg.AutoInstrumentTemplates
+// is false.
+func NRViewsEngine(inner fiber.Views, cfg Config) fiber.Views {
+	if !cfg.AutoInstrumentTemplates {
+		return inner
+	}
+
+	return viewsEngine{Views: inner}
+}
+
+func (v viewsEngine) Render(out io.Writer, name string, bind interface{}, layouts ...string) error {
+	bindMap, _ := bind.(fiber.Map)
+	state, _ := bindMap[viewsStateKey].(*requestState)
+	if state == nil {
+		return v.Views.Render(out, name, bind, layouts...)
+	}
+
+	seg := state.segmentTransaction().StartSegment("render/" + name)
+	if name := formatSegmentName(state.cfg, seg); name != "" {
+		seg.Name = name
+	}
+	defer seg.End()
+
+	return v.Views.Render(out, name, bind, layouts...)
+}
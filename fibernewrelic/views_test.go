@@ -0,0 +1,68 @@
+package fibernewrelic
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// templateViews is a minimal fiber.Views rendering html/template templates.
+type templateViews struct {
+	templates *template.Template
+}
+
+func (v *templateViews) Load() error {
+	var err error
+	v.templates, err = template.New("index").Parse(`<h1>{{.Title}}</h1>`)
+	return err
+}
+
+func (v *templateViews) Render(out io.Writer, name string, bind interface{}, _ ...string) error {
+	return v.templates.ExecuteTemplate(out, name, bind)
+}
+
+func TestNRViewsEngine(t *testing.T) {
+	t.Run("should create a render segment", func(t *testing.T) {
+		// given
+		nrApp, collector := newTestApplication(t)
+		cfg := Config{Application: nrApp, AutoInstrumentTemplates: true}
+
+		app := fiber.New(fiber.Config{Views: NRViewsEngine(&templateViews{}, cfg)})
+		app.Use(New(cfg))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.Render("index", fiber.Map{"Title": "Hello"})
+		})
+
+		// when
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+
+		// then
+		assert.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "<h1>Hello</h1>", string(body))
+
+		assert.Contains(t, collector.metrics(t, nrApp), "Custom/render/index")
+	})
+
+	t.Run("should render requests which are not instrumented", func(t *testing.T) {
+		app := fiber.New(fiber.Config{Views: NRViewsEngine(&templateViews{}, Config{AutoInstrumentTemplates: true})})
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.Render("index", fiber.Map{"Title": "Hello"})
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil), -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should return the engine unchanged when disabled", func(t *testing.T) {
+		views := &templateViews{}
+		assert.Same(t, views, NRViewsEngine(views, Config{}))
+	})
+}